@@ -0,0 +1,394 @@
+// Package conditions parses and evaluates the "when" expressions of operations,
+// such as `vars.os_release includes "22.04" and vars.exit_code == 0`.
+//
+// An expression compares operands with ==, !=, <, <=, >, >=, includes or matches
+// (a regular expression), and combines comparisons with and, or, not (or !) and parentheses.
+// Operands are pipeline variables (vars.<name>), quoted strings, numbers, or true and false.
+// A lone operand is true unless it is empty, "false" or "0".
+package conditions
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr is a parsed condition.
+type Expr interface {
+	// Eval evaluates the condition against the pipeline variables.
+	Eval(vars map[string]string) (bool, error)
+}
+
+// Parse parses a condition.
+func Parse(input string) (Expr, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos+1)
+	}
+	return expr, nil
+}
+
+// tokenKind classifies tokens.
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+)
+
+// token is a lexical element of a condition; pos is its byte offset.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize splits a condition into tokens.
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(input) && input[end] != c {
+				if input[end] == '\\' && c == '"' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, fmt.Errorf("unterminated string at position %d", i+1)
+			}
+			text := input[i+1 : end]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(input[i : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string at position %d: %v", i+1, err)
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, token{tokenString, text, i})
+			i = end + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			op := string(c)
+			if i+1 < len(input) && input[i+1] == '=' {
+				op += "="
+			}
+			if op == "=" {
+				return nil, fmt.Errorf("unknown operator '=' at position %d (use ==)", i+1)
+			}
+			tokens = append(tokens, token{tokenOperator, op, i})
+			i += len(op)
+		case isWordChar(c):
+			start := i
+			for i < len(input) && isWordChar(input[i]) {
+				i++
+			}
+			word := input[start:i]
+			kind := tokenIdent
+			if _, ok := parseNumber(word); ok {
+				kind = tokenNumber
+			}
+			tokens = append(tokens, token{kind, word, start})
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i+1)
+		}
+	}
+	return append(tokens, token{tokenEnd, "end of condition", len(input)}), nil
+}
+
+// isWordChar reports whether c may be part of an identifier or a number.
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-' || c == '+'
+}
+
+// parser is a recursive descent parser over the tokens of a condition.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// peek returns the next token without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the next token.
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEnd {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword reports whether the next token is the given keyword, consuming it if so.
+func (p *parser) keyword(word string) bool {
+	if tok := p.peek(); tok.kind == tokenIdent && tok.text == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseOr parses: and-expr { "or" and-expr }.
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: unary { "and" unary }.
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses: ( "not" | "!" ) unary | "(" or-expr ")" | comparison.
+func (p *parser) parseUnary() (Expr, error) {
+	if tok := p.peek(); tok.kind == tokenOperator && tok.text == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{operand: operand}, nil
+	}
+	if p.keyword("not") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{operand: operand}, nil
+	}
+	if p.peek().kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ')' at position %d, found '%s'", tok.pos+1, tok.text)
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses: operand [ operator operand ].
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	op := ""
+	switch {
+	case tok.kind == tokenOperator && tok.text != "!":
+		op = tok.text
+	case tok.kind == tokenIdent && (tok.text == "includes" || tok.text == "matches"):
+		op = tok.text
+	default:
+		return &truthy{operand: left}, nil
+	}
+	p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	c := &comparison{op: op, left: left, right: right}
+	if op == "matches" {
+		lit, ok := right.(literal)
+		if !ok {
+			return nil, fmt.Errorf("'matches' needs a quoted regular expression at position %d", tok.pos+1)
+		}
+		if c.re, err = regexp.Compile(lit.text); err != nil {
+			return nil, fmt.Errorf("invalid regular expression at position %d: %v", tok.pos+1, err)
+		}
+	}
+	return c, nil
+}
+
+// parseOperand parses a variable reference or a literal.
+func (p *parser) parseOperand() (operand, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		return literal{text: tok.text, quoted: tok.kind == tokenString}, nil
+	case tokenIdent:
+		switch {
+		case tok.text == "true" || tok.text == "false":
+			return literal{text: tok.text}, nil
+		case strings.HasPrefix(tok.text, "vars.") && len(tok.text) > len("vars."):
+			return variable(strings.TrimPrefix(tok.text, "vars.")), nil
+		}
+		return nil, fmt.Errorf("unknown name '%s' at position %d (variables are written vars.<name>)", tok.text, tok.pos+1)
+	}
+	return nil, fmt.Errorf("expected a value at position %d, found '%s'", tok.pos+1, tok.text)
+}
+
+// operand is a value in a condition.
+type operand interface {
+	value(vars map[string]string) string
+}
+
+// literal is a quoted string, number or boolean.
+type literal struct {
+	text string
+	// quoted is set for quoted strings, which always compare as strings.
+	quoted bool
+}
+
+func (l literal) value(map[string]string) string { return l.text }
+
+// variable is a pipeline variable; an undefined variable is empty. Surrounding
+// whitespace, such as the trailing newline of command output, is ignored.
+type variable string
+
+func (v variable) value(vars map[string]string) string { return strings.TrimSpace(vars[string(v)]) }
+
+// logical combines two conditions with and/or, short-circuiting like Go.
+type logical struct {
+	and         bool
+	left, right Expr
+}
+
+func (l *logical) Eval(vars map[string]string) (bool, error) {
+	left, err := l.left.Eval(vars)
+	if err != nil || left != l.and {
+		return left, err
+	}
+	return l.right.Eval(vars)
+}
+
+// negation inverts a condition.
+type negation struct {
+	operand Expr
+}
+
+func (n *negation) Eval(vars map[string]string) (bool, error) {
+	v, err := n.operand.Eval(vars)
+	return !v, err
+}
+
+// truthy is a lone operand used as a condition.
+type truthy struct {
+	operand operand
+}
+
+func (t *truthy) Eval(vars map[string]string) (bool, error) {
+	switch strings.TrimSpace(t.operand.value(vars)) {
+	case "", "false", "0":
+		return false, nil
+	}
+	return true, nil
+}
+
+// comparison compares two operands. == and != compare numerically if both sides are
+// numbers and neither is a quoted string, and as strings otherwise; <, <=, > and >=
+// require numbers, quoted or not.
+type comparison struct {
+	op          string
+	left, right operand
+	re          *regexp.Regexp
+}
+
+func (c *comparison) Eval(vars map[string]string) (bool, error) {
+	left, right := c.left.value(vars), c.right.value(vars)
+	switch c.op {
+	case "includes":
+		return strings.Contains(left, right), nil
+	case "matches":
+		return c.re.MatchString(left), nil
+	}
+
+	l, lOK := parseNumber(left)
+	r, rOK := parseNumber(right)
+	numeric := lOK && rOK
+	// A quoted side asks for a string comparison, e.g. vars.version == "1.1" for "1.10".
+	equalNumbers := numeric && !isQuoted(c.left) && !isQuoted(c.right)
+	switch c.op {
+	case "==":
+		if equalNumbers {
+			return l == r, nil
+		}
+		return left == right, nil
+	case "!=":
+		if equalNumbers {
+			return l != r, nil
+		}
+		return left != right, nil
+	}
+	if !numeric {
+		return false, fmt.Errorf("cannot compare '%s' %s '%s': both sides must be numbers", left, c.op, right)
+	}
+	switch c.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	}
+	return l >= r, nil
+}
+
+// isQuoted reports whether an operand is a quoted string.
+func isQuoted(o operand) bool {
+	lit, ok := o.(literal)
+	return ok && lit.quoted
+}
+
+// parseNumber parses a finite number. Words such as "inf" and "NaN", which
+// strconv.ParseFloat would accept, are not numbers in conditions.
+func parseNumber(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,149 @@
+package conditions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]string{
+		"os":        "Ubuntu 22.04.3 LTS\n",
+		"exit_code": "0\n",
+		"count":     "10",
+		"version":   "1.10",
+		"empty":     "",
+		"word":      "inf",
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Precedence: not binds tighter than and, and tighter than or.
+		{`true or false and false`, true},
+		{`(true or false) and false`, false},
+		{`not false and false`, false},
+		{`not (false and false)`, true},
+		{`false or not false`, true},
+		{`false and true or true`, true},
+
+		// ! is the same as not.
+		{`!false`, true},
+		{`! vars.empty`, true},
+		{`!(vars.count == 10)`, false},
+		{`!!true`, true},
+		{`vars.count != 10`, false},
+
+		// Parentheses.
+		{`((true))`, true},
+		{`(vars.count > 5) and (vars.os includes "22.04")`, true},
+		{`vars.count > 5 and (vars.os includes "20.04" or vars.exit_code == 0)`, true},
+
+		// Numbers compare numerically if both sides are numbers; a quoted side
+		// compares as a string.
+		{`vars.exit_code == 0`, true},
+		{`vars.count == 10.0`, true},
+		{`vars.count == "10.0"`, false},
+		{`vars.count == "10"`, true},
+		{`vars.version == 1.1`, true},
+		{`vars.version == "1.1"`, false},
+		{`vars.version == "1.10"`, true},
+		{`vars.version != "1.1"`, true},
+		{`"1.0" == 1`, false},
+		{`vars.count > "9"`, true},
+		{`vars.os == "Ubuntu 22.04.3 LTS"`, true},
+		{`vars.os != "ubuntu 22.04.3 lts"`, true},
+		{`vars.count > 9`, true},
+		{`vars.count >= 10`, true},
+		{`vars.count < 9.5`, false},
+		{`vars.count <= -1`, false},
+		{`vars.os matches "^Ubuntu 2[0-9]\\."`, true},
+
+		// Non-finite values are strings, not numbers.
+		{`vars.word == "inf"`, true},
+		{`vars.word == "Infinity"`, false},
+		{`"nan" == "NaN"`, false},
+
+		// Undefined variables are empty.
+		{`vars.missing`, false},
+		{`not vars.missing`, true},
+		{`vars.missing == ""`, true},
+		{`vars.missing != 0`, true},
+		{`vars.missing includes ""`, true},
+
+		// A lone value is true unless it is empty, "false" or "0".
+		{`vars.exit_code`, false},
+		{`vars.count`, true},
+		{`"false"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := expr.Eval(vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	vars := map[string]string{"os": "Ubuntu", "word": "inf"}
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{`vars.os > 1`, "both sides must be numbers"},
+		{`vars.missing < 1`, "both sides must be numbers"},
+		{`vars.word >= 1`, "both sides must be numbers"},
+		// The right side is not evaluated if the left side decides.
+		{`false and vars.os > 1 or vars.os < 1`, "both sides must be numbers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := expr.Eval(vars); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{``, "expected a value at position 1"},
+		{`vars.a ==`, "expected a value at position 10"},
+		{`vars.a = 1`, "unknown operator '='"},
+		{`(vars.a == 1`, "expected ')'"},
+		{`vars.a == 1)`, "unexpected ')'"},
+		{`vars.a == "open`, "unterminated string"},
+		{`os == 1`, "unknown name 'os'"},
+		{`vars. == 1`, "unknown name 'vars.'"},
+		{`vars.a == inf`, "unknown name 'inf'"},
+		{`vars.a matches vars.b`, "needs a quoted regular expression"},
+		{`vars.a matches "("`, "invalid regular expression"},
+		{`vars.a == 1 vars.b`, "unexpected 'vars.b'"},
+		{`vars.a ! 1`, "unexpected '!'"},
+		{`vars.a & 1`, "unexpected character '&'"},
+		{`not`, "expected a value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,15 +3,26 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // VMUser represents a user credential with a role.
+// The password is given either inline, or read from a file (PasswordFile), an
+// environment variable (PasswordEnv) or the output of a shell command (PasswordCommand)
+// by ResolvePassword.
 type VMUser struct {
-	Role     string `yaml:"role"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Role            string `yaml:"role"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password,omitempty"`
+	PasswordFile    string `yaml:"password_file,omitempty"`
+	PasswordEnv     string `yaml:"password_env,omitempty"`
+	PasswordCommand string `yaml:"password_command,omitempty"`
+
+	// resolved is set once ResolvePassword has filled in Password.
+	resolved bool
 }
 
 // VMConfig holds the VirtualBox VM configuration.
@@ -22,44 +33,125 @@ type VMConfig struct {
 }
 
 // Operation represents an operation to perform on a VM.
-// It includes optional Role and StoreAs fields.
+// It includes optional Role, StoreAs and Timeout fields.
 type Operation struct {
 	Type        string                 `yaml:"type"`
 	Role        string                 `yaml:"role,omitempty"`
 	StoreAs     string                 `yaml:"store_as,omitempty"`
 	Params      map[string]interface{} `yaml:"params"`
 	PrintOutput bool                   `yaml:"print_output,omitempty"`
+	Timeout     string                 `yaml:"timeout,omitempty"`
+	// When is a condition on the pipeline variables (see package conditions);
+	// the operation is skipped unless it holds.
+	When string `yaml:"when,omitempty"`
+	// Retries is how many times a failed operation is retried, waiting RetryDelay
+	// (default 5s) before the first retry. RetryBackoff "linear" or "exponential"
+	// grows the delay with each retry, and RetryOn limits retries to errors matching
+	// one of its regular expressions.
+	Retries      int      `yaml:"retries,omitempty"`
+	RetryDelay   string   `yaml:"retry_delay,omitempty"`
+	RetryBackoff string   `yaml:"retry_backoff,omitempty"`
+	RetryOn      []string `yaml:"retry_on,omitempty"`
+	// Sensitive marks the operation's output, including the variable named by StoreAs,
+	// as a secret that is masked in logs and reports.
+	Sensitive bool `yaml:"sensitive,omitempty"`
 }
 
 // JobConfig represents a job to perform on a VM.
+// Name identifies the job, and DependsOn lists the names of jobs that must succeed
+// before this job runs.
 type JobConfig struct {
+	Name              string      `yaml:"name,omitempty"`
+	DependsOn         []string    `yaml:"depends_on,omitempty"`
 	VMAlias           string      `yaml:"vm_alias"`
 	EnsureOff         bool        `yaml:"ensure_off,omitempty"`
 	RollbackOnFailure string      `yaml:"rollback_on_failure,omitempty"`
+	Timeout           string      `yaml:"timeout,omitempty"`
 	Operations        []Operation `yaml:"operations"`
+	// OnFailure, OnSuccess and Always are cleanup operations that run after the
+	// operations, depending on the job's outcome, and before any rollback.
+	OnFailure []Operation `yaml:"on_failure,omitempty"`
+	OnSuccess []Operation `yaml:"on_success,omitempty"`
+	Always    []Operation `yaml:"always,omitempty"`
+}
+
+// VirtualBoxConfig holds settings for the "virtualbox" backend.
+// VBoxManagePath is the VBoxManage binary (default: "VBoxManage" from PATH).
+// RecordTranscript writes every VBoxManage call and its output to a JSON file,
+// and ReplayTranscript answers the calls from such a file instead of running VBoxManage.
+type VirtualBoxConfig struct {
+	VBoxManagePath   string `yaml:"vboxmanage_path,omitempty"`
+	RecordTranscript string `yaml:"record_transcript,omitempty"`
+	ReplayTranscript string `yaml:"replay_transcript,omitempty"`
+}
+
+// QEMUConfig holds settings for the "qemu" backend.
+// ConnectURI is the libvirt connection URI (e.g. "qemu:///system"); empty means the libvirt default.
+type QEMUConfig struct {
+	ConnectURI string `yaml:"connect_uri,omitempty"`
 }
 
 // Config represents the complete configuration for the VM manager.
-// The vm_manager field is used to flexibly select the backend (e.g. "virtualbox").
+// The vm_manager field is used to flexibly select the backend ("virtualbox", "qemu" or "fake"),
+// the virtualbox section configures how VBoxManage is run, the qemu section configures the libvirt connection of the "qemu" backend, and the
+// fake section declares the simulated VMs and guest command responses of the "fake" backend.
+// The max_parallel field caps how many jobs targeting different VMs run concurrently,
+// artifacts_dir is where files copied out of guests are stored (default "artifacts"),
+// and strict_templates makes undefined template variables in params an error.
 type Config struct {
-	VMManager string      `yaml:"vm_manager"`
-	VMs       []VMConfig  `yaml:"vms"`
-	Jobs      []JobConfig `yaml:"jobs"`
+	VMManager       string           `yaml:"vm_manager"`
+	MaxParallel     int              `yaml:"max_parallel,omitempty"`
+	ArtifactsDir    string           `yaml:"artifacts_dir,omitempty"`
+	StrictTemplates bool             `yaml:"strict_templates,omitempty"`
+	VirtualBox      VirtualBoxConfig `yaml:"virtualbox,omitempty"`
+	QEMU            QEMUConfig       `yaml:"qemu,omitempty"`
+	Fake            FakeConfig       `yaml:"fake,omitempty"`
+	VMs             []VMConfig       `yaml:"vms"`
+	Jobs            []JobConfig      `yaml:"jobs"`
 }
 
-// loadConfig loads the configuration from the given file path.
+// LoadConfig loads the configuration from the given file path.
+// The file is validated first, so that mistakes are reported before any VM is touched.
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	if err := Validate(data); err != nil {
+		return nil, err
+	}
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	if err := assignJobNames(cfg.Jobs); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
+// ParseTimeout parses a timeout given either as a Go duration ("90s", "5m") or as
+// a plain number of seconds ("90"). An empty string means no timeout and yields zero.
+func ParseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("invalid timeout '%s': must not be negative", value)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout '%s': %w", value, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid timeout '%s': must not be negative", value)
+	}
+	return d, nil
+}
+
 // GetVMConfig finds a VM configuration by its alias.
 func GetVMConfig(vms []VMConfig, alias string) (*VMConfig, error) {
 	for _, vm := range vms {
@@ -71,10 +163,11 @@ func GetVMConfig(vms []VMConfig, alias string) (*VMConfig, error) {
 }
 
 // GetUserByRole returns the VMUser for the given role from a VMConfig.
+// The user is shared with the VMConfig, so a resolved password is kept.
 func GetUserByRole(vm *VMConfig, role string) (*VMUser, error) {
-	for _, user := range vm.Users {
-		if user.Role == role {
-			return &user, nil
+	for i := range vm.Users {
+		if vm.Users[i].Role == role {
+			return &vm.Users[i], nil
 		}
 	}
 	return nil, fmt.Errorf("user with role '%s' not found for VM '%s'", role, vm.VMName)
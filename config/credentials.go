@@ -0,0 +1,55 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"vnecro/redact"
+)
+
+// passwordMu serializes password resolution, which fills in VMUser fields in place.
+var passwordMu sync.Mutex
+
+// ResolvePassword reads the user's password from its configured source, if any, so
+// that secrets need not be stored in the configuration file. The source is read when
+// a job first needs the credentials, not when the configuration is loaded or validated,
+// and the password is kept for later calls and registered for redaction.
+// A trailing line break is stripped from file contents and command output.
+func (u *VMUser) ResolvePassword() error {
+	passwordMu.Lock()
+	defer passwordMu.Unlock()
+	if u.resolved {
+		return nil
+	}
+
+	switch {
+	case u.PasswordFile != "":
+		data, err := os.ReadFile(u.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("error reading password_file: %w", err)
+		}
+		u.Password = strings.TrimRight(string(data), "\r\n")
+	case u.PasswordEnv != "":
+		password, ok := os.LookupEnv(u.PasswordEnv)
+		if !ok {
+			return fmt.Errorf("password_env: environment variable '%s' is not set", u.PasswordEnv)
+		}
+		u.Password = password
+	case u.PasswordCommand != "":
+		cmd := exec.Command("sh", "-c", u.PasswordCommand)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("error running password_command: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		u.Password = strings.TrimRight(stdout.String(), "\r\n")
+	}
+	redact.Add(u.Password)
+	u.resolved = true
+	return nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigDoesNotResolvePasswords(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	path := filepath.Join(dir, "config.yaml")
+	content := `
+vm_manager: virtualbox
+vms:
+  - alias: vm
+    vm_name: vm1
+    users:
+      - role: user
+        username: tester
+        password_command: "touch ` + marker + `; echo secret"
+jobs: []
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("password_command ran while loading the configuration")
+	}
+
+	user, err := GetUserByRole(&cfg.VMs[0], "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := user.ResolvePassword(); err != nil {
+		t.Fatal(err)
+	}
+	if user.Password != "secret" {
+		t.Errorf("password = %q, want %q", user.Password, "secret")
+	}
+	// The resolved password is kept, so the command does not run again.
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := GetUserByRole(&cfg.VMs[0], "user")
+	if err := again.ResolvePassword(); err != nil || again.Password != "secret" {
+		t.Fatalf("second resolution: %q, %v", again.Password, err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("password_command ran twice")
+	}
+}
+
+func TestResolvePasswordFromEnv(t *testing.T) {
+	t.Setenv("VNECRO_TEST_PASSWORD", "from-env")
+	user := VMUser{PasswordEnv: "VNECRO_TEST_PASSWORD"}
+	if err := user.ResolvePassword(); err != nil || user.Password != "from-env" {
+		t.Errorf("password = %q, %v", user.Password, err)
+	}
+
+	unset := VMUser{PasswordEnv: "VNECRO_TEST_UNSET"}
+	if err := unset.ResolvePassword(); err == nil {
+		t.Error("expected an error for an unset environment variable")
+	}
+}
+
+func TestValidatePasswordSources(t *testing.T) {
+	tests := map[string]string{
+		"none":    "",
+		"several": "\n        password: secret\n        password_env: PASSWORD",
+	}
+	for name, sources := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := Validate([]byte(`
+vm_manager: virtualbox
+vms:
+  - alias: vm
+    vm_name: vm1
+    users:
+      - role: user
+        username: tester` + sources + `
+jobs: []
+`))
+			if err == nil || !strings.Contains(err.Error(), "exactly one of password") {
+				t.Errorf("error = %v, want an error about the password sources", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+// FakeConfig holds the simulated world of the "fake" backend, which runs jobs
+// against in-memory VMs instead of a real hypervisor.
+type FakeConfig struct {
+	VMs      []FakeVM      `yaml:"vms,omitempty"`
+	Commands []FakeCommand `yaml:"commands,omitempty"`
+}
+
+// FakeVM describes the initial state of a simulated VM. VMs that are not listed
+// start powered off, without snapshots or guest files.
+// State is one of "poweroff" (default), "running", "paused", "saved" or "aborted",
+// Files maps guest paths to file contents available to CopyFromGuest, and
+// IgnoreACPI simulates a guest that does not react to an ACPI shutdown.
+type FakeVM struct {
+	VMName          string            `yaml:"vm_name"`
+	State           string            `yaml:"state,omitempty"`
+	Snapshots       []FakeSnapshot    `yaml:"snapshots,omitempty"`
+	CurrentSnapshot string            `yaml:"current_snapshot,omitempty"`
+	Files           map[string]string `yaml:"files,omitempty"`
+	IgnoreACPI      bool              `yaml:"ignore_acpi,omitempty"`
+}
+
+// FakeSnapshot describes a simulated snapshot and its child snapshots.
+type FakeSnapshot struct {
+	Name        string         `yaml:"name"`
+	UUID        string         `yaml:"uuid,omitempty"`
+	Description string         `yaml:"description,omitempty"`
+	Children    []FakeSnapshot `yaml:"children,omitempty"`
+}
+
+// FakeCommand scripts the response of a guest command. Command is matched against
+// the full command line (the command followed by its arguments, separated by spaces)
+// or, failing that, against the command alone; the first matching entry wins.
+// An empty VMName matches every VM.
+type FakeCommand struct {
+	VMName   string `yaml:"vm_name,omitempty"`
+	Command  string `yaml:"command"`
+	Stdout   string `yaml:"stdout,omitempty"`
+	Stderr   string `yaml:"stderr,omitempty"`
+	ExitCode int    `yaml:"exit_code,omitempty"`
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// generatedJobName matches the names given to unnamed jobs, which explicit names may
+// not use, so that a generated name never clashes with an explicit one.
+var generatedJobName = regexp.MustCompile(`^job-[0-9]+$`)
+
+// assignJobNames gives every unnamed job a positional name and rejects duplicates,
+// so that each job can be referenced from depends_on and in logs.
+func assignJobNames(jobs []JobConfig) error {
+	seen := make(map[string]bool)
+	for i := range jobs {
+		if jobs[i].Name == "" {
+			jobs[i].Name = fmt.Sprintf("job-%d", i+1)
+		} else if generatedJobName.MatchString(jobs[i].Name) {
+			return fmt.Errorf("job name '%s' is reserved for unnamed jobs", jobs[i].Name)
+		}
+		if seen[jobs[i].Name] {
+			return fmt.Errorf("duplicate job name '%s'", jobs[i].Name)
+		}
+		seen[jobs[i].Name] = true
+	}
+	return nil
+}
+
+// JobOrder returns the indices of jobs in topological order of their depends_on edges.
+// Among jobs whose dependencies are satisfied, the configured list order is kept.
+// Returns an error if a dependency refers to an unknown job or if the graph has a cycle.
+func JobOrder(jobs []JobConfig) ([]int, error) {
+	index := make(map[string]int, len(jobs))
+	for i, job := range jobs {
+		index[job.Name] = i
+	}
+
+	// Count unresolved dependencies and collect the reverse edges.
+	remaining := make([]int, len(jobs))
+	dependents := make([][]int, len(jobs))
+	for i, job := range jobs {
+		for _, dep := range job.DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("job '%s' depends on unknown job '%s'", job.Name, dep)
+			}
+			if j == i {
+				return nil, fmt.Errorf("job '%s' depends on itself", job.Name)
+			}
+			remaining[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	// Repeatedly take the first job in list order with no unresolved dependencies.
+	order := make([]int, 0, len(jobs))
+	done := make([]bool, len(jobs))
+	for len(order) < len(jobs) {
+		next := -1
+		for i := range jobs {
+			if !done[i] && remaining[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			return nil, fmt.Errorf("dependency cycle between jobs: %s", strings.Join(cycleMembers(jobs, done), ", "))
+		}
+		done[next] = true
+		order = append(order, next)
+		for _, d := range dependents[next] {
+			remaining[d]--
+		}
+	}
+	return order, nil
+}
+
+// cycleMembers returns the names of the jobs that could not be ordered.
+func cycleMembers(jobs []JobConfig, done []bool) []string {
+	var names []string
+	for i, job := range jobs {
+		if !done[i] {
+			names = append(names, job.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssignJobNames(t *testing.T) {
+	jobs := []JobConfig{{Name: "build"}, {}, {Name: "test"}}
+	if err := assignJobNames(jobs); err != nil {
+		t.Fatal(err)
+	}
+	if jobs[1].Name != "job-2" {
+		t.Errorf("unnamed job is named %q, want job-2", jobs[1].Name)
+	}
+
+	for _, jobs := range [][]JobConfig{
+		{{Name: "job-2"}, {}},
+		{{}, {Name: "job-1"}},
+	} {
+		if err := assignJobNames(jobs); err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Errorf("error = %v, want a reserved name error", err)
+		}
+	}
+}
+
+func TestValidateRejectsGeneratedJobNames(t *testing.T) {
+	err := Validate([]byte(`
+vm_manager: virtualbox
+vms:
+  - alias: vm
+    vm_name: vm1
+jobs:
+  - name: job-2
+    vm_alias: vm
+    operations:
+      - type: StartVM
+  - vm_alias: vm
+    operations:
+      - type: StartVM
+`))
+	if err == nil || !strings.Contains(err.Error(), "line 7") || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("error = %v, want a reserved name error on line 7", err)
+	}
+}
@@ -0,0 +1,276 @@
+package config
+
+import "vnecro/vmTypes"
+
+// paramKind is the YAML shape a parameter value must have.
+type paramKind int
+
+const (
+	kindString paramKind = iota
+	kindBool
+	kindInt
+	kindStringList
+	kindStringOrList
+	kindIntList
+	kindMapping
+	kindMappingList
+	kindDuration
+)
+
+// String describes the kind for validation messages.
+func (k paramKind) String() string {
+	switch k {
+	case kindString:
+		return "a string"
+	case kindBool:
+		return "true or false"
+	case kindInt:
+		return "an integer"
+	case kindStringList:
+		return "a list of strings"
+	case kindStringOrList:
+		return "a string or a list of strings"
+	case kindIntList:
+		return "a list of integers"
+	case kindMapping:
+		return "a mapping"
+	case kindMappingList:
+		return "a list of mappings"
+	case kindDuration:
+		return "a duration such as \"90s\" or a number of seconds"
+	}
+	return "unknown"
+}
+
+// paramSpec describes one parameter of an operation.
+type paramSpec struct {
+	kind     paramKind
+	required bool
+	// values, if set, lists the accepted values of a string parameter.
+	values []string
+	// fields describes the keys of a mapping (or of each item of a list of mappings).
+	// A nil fields map accepts any keys.
+	fields map[string]paramSpec
+}
+
+// configFields describes the top-level keys of a configuration file.
+var configFields = map[string]paramSpec{
+	"vm_manager":       {kind: kindString, required: true, values: []string{"virtualbox", "qemu", "fake"}},
+	"max_parallel":     {kind: kindInt},
+	"artifacts_dir":    {kind: kindString},
+	"strict_templates": {kind: kindBool},
+	"virtualbox": {kind: kindMapping, fields: map[string]paramSpec{
+		"vboxmanage_path":   {kind: kindString},
+		"record_transcript": {kind: kindString},
+		"replay_transcript": {kind: kindString},
+	}},
+	"qemu": {kind: kindMapping, fields: map[string]paramSpec{
+		"connect_uri": {kind: kindString},
+	}},
+	"fake": {kind: kindMapping, fields: map[string]paramSpec{
+		"vms": {kind: kindMappingList, fields: map[string]paramSpec{
+			"vm_name":          {kind: kindString, required: true},
+			"state":            {kind: kindString, values: []string{"poweroff", "running", "paused", "saved", "aborted"}},
+			"snapshots":        {kind: kindMappingList, fields: fakeSnapshotFields},
+			"current_snapshot": {kind: kindString},
+			"files":            {kind: kindMapping},
+			"ignore_acpi":      {kind: kindBool},
+		}},
+		"commands": {kind: kindMappingList, fields: map[string]paramSpec{
+			"vm_name":   {kind: kindString},
+			"command":   {kind: kindString, required: true},
+			"stdout":    {kind: kindString},
+			"stderr":    {kind: kindString},
+			"exit_code": {kind: kindInt},
+		}},
+	}},
+	"vms":  {kind: kindMappingList, fields: vmFields},
+	"jobs": {kind: kindMappingList, fields: jobFields},
+}
+
+// vmStateNames returns the names of the VM states a backend reports.
+func vmStateNames() []string {
+	names := make([]string, len(vmTypes.KnownStates))
+	for i, state := range vmTypes.KnownStates {
+		names[i] = string(state)
+	}
+	return names
+}
+
+// fakeSnapshotFields describes the keys of a FakeSnapshot. Its children are
+// FakeSnapshots as well, so the recursive entry is added in init.
+var fakeSnapshotFields = map[string]paramSpec{
+	"name":        {kind: kindString, required: true},
+	"uuid":        {kind: kindString},
+	"description": {kind: kindString},
+}
+
+func init() {
+	fakeSnapshotFields["children"] = paramSpec{kind: kindMappingList, fields: fakeSnapshotFields}
+}
+
+// vmFields describes the keys of a VMConfig.
+var vmFields = map[string]paramSpec{
+	"alias":   {kind: kindString, required: true},
+	"vm_name": {kind: kindString, required: true},
+	"users": {kind: kindMappingList, fields: map[string]paramSpec{
+		"role":             {kind: kindString, required: true},
+		"username":         {kind: kindString, required: true},
+		"password":         {kind: kindString},
+		"password_file":    {kind: kindString},
+		"password_env":     {kind: kindString},
+		"password_command": {kind: kindString},
+	}},
+}
+
+// jobFields describes the keys of a JobConfig.
+var jobFields = map[string]paramSpec{
+	"name":                {kind: kindString},
+	"depends_on":          {kind: kindStringList},
+	"vm_alias":            {kind: kindString, required: true},
+	"ensure_off":          {kind: kindBool},
+	"rollback_on_failure": {kind: kindString},
+	"timeout":             {kind: kindDuration},
+	"operations":          {kind: kindMappingList, fields: operationFields},
+	"on_failure":          {kind: kindMappingList, fields: operationFields},
+	"on_success":          {kind: kindMappingList, fields: operationFields},
+	"always":              {kind: kindMappingList, fields: operationFields},
+}
+
+// operationFields describes the keys of an Operation; its params are checked
+// against the operation's schema separately.
+var operationFields = map[string]paramSpec{
+	"type":          {kind: kindString, required: true},
+	"role":          {kind: kindString},
+	"store_as":      {kind: kindString},
+	"params":        {kind: kindMapping},
+	"print_output":  {kind: kindBool},
+	"timeout":       {kind: kindDuration},
+	"when":          {kind: kindString},
+	"retries":       {kind: kindInt},
+	"retry_delay":   {kind: kindDuration},
+	"retry_backoff": {kind: kindString, values: []string{"linear", "exponential"}},
+	"retry_on":      {kind: kindStringList},
+	"sensitive":     {kind: kindBool},
+}
+
+// operationSchema describes the parameters an operation type accepts.
+type operationSchema struct {
+	params map[string]paramSpec
+	// exclusive lists groups of parameters of which at most one may be given.
+	exclusive [][]string
+	// oneOf lists groups of parameters of which exactly one must be given.
+	oneOf [][]string
+	// usesRole marks operations that log into the guest with the credentials of their role.
+	usesRole bool
+}
+
+// operationSchemas maps every supported operation type to its parameter schema.
+var operationSchemas = map[string]operationSchema{
+	"RestoreSnapshot": {
+		params: map[string]paramSpec{
+			"snapshot": {kind: kindString},
+			"uuid":     {kind: kindString},
+			"target":   {kind: kindString, values: []string{"current", "latest"}},
+		},
+		exclusive: [][]string{{"snapshot", "uuid", "target"}},
+	},
+	"TakeSnapshot": {
+		params: map[string]paramSpec{
+			"name":        {kind: kindString, required: true},
+			"description": {kind: kindString},
+			"live":        {kind: kindBool},
+			"retain": {kind: kindMapping, fields: map[string]paramSpec{
+				"prefix": {kind: kindString, required: true},
+				"keep":   {kind: kindInt, required: true},
+			}},
+		},
+	},
+	"DeleteSnapshot": {
+		params: map[string]paramSpec{
+			"snapshot": {kind: kindString},
+			"uuid":     {kind: kindString},
+		},
+		oneOf: [][]string{{"snapshot", "uuid"}},
+	},
+	"StartVM":   {},
+	"PauseVM":   {},
+	"ResumeVM":  {},
+	"ResetVM":   {},
+	"SaveState": {},
+	"ShutdownVM": {
+		params: map[string]paramSpec{
+			"mode":         {kind: kindString, values: []string{"acpi", "poweroff", "savestate"}},
+			"grace_period": {kind: kindDuration},
+		},
+	},
+	"WaitForState": {
+		params: map[string]paramSpec{
+			"state":    {kind: kindStringOrList, required: true, values: vmStateNames()},
+			"interval": {kind: kindDuration},
+		},
+	},
+	"ExecuteShellCommand": {
+		params: map[string]paramSpec{
+			"command":             {kind: kindString, required: true},
+			"args":                {kind: kindStringList},
+			"shell":               {kind: kindString, values: []string{"sh", "bash"}},
+			"resolve":             {kind: kindString, values: []string{"bin", "path"}},
+			"env":                 {kind: kindMapping},
+			"cwd":                 {kind: kindString},
+			"stdin":               {kind: kindString},
+			"allow_failure":       {kind: kindBool},
+			"expected_exit_codes": {kind: kindIntList},
+			"max_output_bytes":    {kind: kindInt},
+		},
+		usesRole: true,
+	},
+	"RunScript": {
+		params: map[string]paramSpec{
+			"path":                {kind: kindString},
+			"script":              {kind: kindString},
+			"interpreter":         {kind: kindString},
+			"args":                {kind: kindStringList},
+			"resolve":             {kind: kindString, values: []string{"bin", "path"}},
+			"env":                 {kind: kindMapping},
+			"cwd":                 {kind: kindString},
+			"stdin":               {kind: kindString},
+			"allow_failure":       {kind: kindBool},
+			"expected_exit_codes": {kind: kindIntList},
+			"max_output_bytes":    {kind: kindInt},
+		},
+		oneOf:    [][]string{{"path", "script"}},
+		usesRole: true,
+	},
+	"CopyToGuest": {
+		params: map[string]paramSpec{
+			"source":      {kind: kindStringOrList, required: true},
+			"destination": {kind: kindString, required: true},
+			"recursive":   {kind: kindBool},
+			"mode":        {kind: kindString},
+		},
+		usesRole: true,
+	},
+	"CopyFromGuest": {
+		params: map[string]paramSpec{
+			"source":      {kind: kindStringOrList, required: true},
+			"destination": {kind: kindString},
+			"recursive":   {kind: kindBool},
+			"mode":        {kind: kindString},
+		},
+		usesRole: true,
+	},
+	"Assert": {
+		params: map[string]paramSpec{
+			"variable": {kind: kindString, required: true},
+			"operator": {kind: kindString, required: true, values: []string{"equal", "includes", "greater", "smaller"}},
+			"expected": {kind: kindString, required: true},
+			"type":     {kind: kindString, values: []string{"string", "int", "float"}},
+		},
+	},
+	"Wait": {
+		params: map[string]paramSpec{
+			"seconds": {kind: kindString, required: true},
+		},
+	},
+}
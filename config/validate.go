@@ -0,0 +1,401 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"vnecro/conditions"
+)
+
+// Problem is a single issue found while validating a configuration file.
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// String formats the problem with its position in the file.
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+}
+
+// ValidationError lists every problem found in a configuration file.
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Error lists the problems, one per line.
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return fmt.Sprintf("%d configuration problem(s):\n  %s", len(e.Problems), strings.Join(lines, "\n  "))
+}
+
+// Validate checks a YAML configuration document without touching any VM: unknown keys,
+// value types, operation types and their parameters, VM aliases, roles, job names,
+// dependencies and timeouts. It returns a *ValidationError listing every problem with
+// its line and column, or the YAML syntax error if the document cannot be parsed.
+func Validate(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return &ValidationError{Problems: []Problem{{Line: 1, Column: 1, Message: "configuration is empty"}}}
+	}
+
+	v := &validator{}
+	root := resolveAlias(doc.Content[0])
+	if v.checkValue(root, paramSpec{kind: kindMapping, fields: configFields}, "configuration") {
+		v.checkSemantics(root)
+	}
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		if v.problems[i].Line != v.problems[j].Line {
+			return v.problems[i].Line < v.problems[j].Line
+		}
+		return v.problems[i].Column < v.problems[j].Column
+	})
+	return &ValidationError{Problems: v.problems}
+}
+
+// validator collects problems while walking a configuration document.
+type validator struct {
+	problems []Problem
+}
+
+// addf records a problem at the position of the given node.
+func (v *validator) addf(n *yaml.Node, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+// resolveAlias follows YAML aliases (*anchor) to the node they refer to.
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// mappingValue returns the value node of key in a mapping node, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return resolveAlias(n.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// sequenceItems returns the items of a sequence node, or nil.
+func sequenceItems(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	items := make([]*yaml.Node, len(n.Content))
+	for i, item := range n.Content {
+		items[i] = resolveAlias(item)
+	}
+	return items
+}
+
+// isScalar reports whether n is a scalar with the given YAML tag.
+func isScalar(n *yaml.Node, tag string) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == tag
+}
+
+// checkValue checks that a node matches the spec, recursing into mappings and lists.
+// Returns false if the node does not have the expected shape.
+func (v *validator) checkValue(n *yaml.Node, spec paramSpec, name string) bool {
+	n = resolveAlias(n)
+	// An empty optional value (e.g. "params:" with nothing after it) is allowed.
+	if isScalar(n, "!!null") && !spec.required {
+		return true
+	}
+	ok := true
+	switch spec.kind {
+	case kindString:
+		ok = isScalar(n, "!!str")
+		if ok {
+			v.checkEnum(n, spec, name)
+		}
+	case kindBool:
+		ok = isScalar(n, "!!bool")
+	case kindInt:
+		ok = isScalar(n, "!!int")
+	case kindDuration:
+		ok = isScalar(n, "!!str") || isScalar(n, "!!int")
+		if ok {
+			if _, err := ParseTimeout(n.Value); err != nil {
+				v.addf(n, "'%s': %v", name, err)
+			}
+		}
+	case kindStringOrList:
+		if isScalar(n, "!!str") {
+			v.checkEnum(n, spec, name)
+			break
+		}
+		fallthrough
+	case kindStringList:
+		ok = n.Kind == yaml.SequenceNode
+		for _, item := range sequenceItems(n) {
+			if !isScalar(item, "!!str") {
+				v.addf(item, "every item of '%s' must be a string", name)
+			} else {
+				v.checkEnum(item, spec, name)
+			}
+		}
+	case kindIntList:
+		ok = n.Kind == yaml.SequenceNode
+		for _, item := range sequenceItems(n) {
+			if !isScalar(item, "!!int") {
+				v.addf(item, "every item of '%s' must be an integer", name)
+			}
+		}
+	case kindMapping:
+		ok = n.Kind == yaml.MappingNode
+		if ok && spec.fields != nil {
+			v.checkFields(n, spec.fields, name)
+		}
+	case kindMappingList:
+		ok = n.Kind == yaml.SequenceNode
+		for i, item := range sequenceItems(n) {
+			v.checkValue(item, paramSpec{kind: kindMapping, fields: spec.fields}, fmt.Sprintf("%s[%d]", name, i))
+		}
+	}
+	if !ok {
+		v.addf(n, "'%s' must be %s", name, spec.kind)
+	}
+	return ok
+}
+
+// checkEnum checks a string scalar against the spec's accepted values, if any.
+// Templated values are only known at run time and are not checked.
+func (v *validator) checkEnum(n *yaml.Node, spec paramSpec, name string) {
+	if spec.values != nil && !strings.Contains(n.Value, "{{") && !containsString(spec.values, n.Value) {
+		v.addf(n, "invalid value '%s' for '%s', expected one of: %s", n.Value, name, strings.Join(spec.values, ", "))
+	}
+}
+
+// checkFields checks the keys of a mapping node against the given fields:
+// unknown keys, missing required keys and the value of every known key.
+func (v *validator) checkFields(n *yaml.Node, fields map[string]paramSpec, name string) {
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		spec, known := fields[key.Value]
+		if !known {
+			v.addf(key, "unknown key '%s' in %s (expected one of: %s)", key.Value, name, strings.Join(sortedKeys(fields), ", "))
+			continue
+		}
+		if seen[key.Value] {
+			v.addf(key, "duplicate key '%s' in %s", key.Value, name)
+		}
+		seen[key.Value] = true
+		v.checkValue(value, spec, key.Value)
+	}
+	for _, key := range sortedKeys(fields) {
+		if fields[key].required && !seen[key] {
+			v.addf(n, "missing required key '%s' in %s", key, name)
+		}
+	}
+}
+
+// checkSemantics checks the cross-references of a structurally valid configuration:
+// unique aliases and job names, VM aliases, roles, operation parameters and dependencies.
+func (v *validator) checkSemantics(root *yaml.Node) {
+	// Collect the VMs and the roles of their users.
+	roles := make(map[string]map[string]bool)
+	for _, vm := range sequenceItems(mappingValue(root, "vms")) {
+		alias := mappingValue(vm, "alias")
+		if alias == nil {
+			continue
+		}
+		if _, dup := roles[alias.Value]; dup {
+			v.addf(alias, "duplicate VM alias '%s'", alias.Value)
+		}
+		roles[alias.Value] = make(map[string]bool)
+		for _, user := range sequenceItems(mappingValue(vm, "users")) {
+			if role := mappingValue(user, "role"); role != nil {
+				roles[alias.Value][role.Value] = true
+			}
+			// Only the choice of source is checked; it is read when a job needs the password.
+			if given := givenKeys(user, passwordSources); len(given) != 1 {
+				v.addf(user, "VM '%s': exactly one of %s must be given", alias.Value, strings.Join(passwordSources, ", "))
+			}
+		}
+	}
+
+	// Check each job and collect its name and dependencies.
+	jobsNode := mappingValue(root, "jobs")
+	jobNodes := sequenceItems(jobsNode)
+	jobs := make([]JobConfig, len(jobNodes))
+	names := make(map[string]bool)
+	for i, jobNode := range jobNodes {
+		jobs[i].Name = fmt.Sprintf("job-%d", i+1)
+		if name := mappingValue(jobNode, "name"); name != nil && name.Value != "" {
+			jobs[i].Name = name.Value
+			switch {
+			case generatedJobName.MatchString(name.Value):
+				v.addf(name, "job name '%s' is reserved for unnamed jobs", name.Value)
+			case names[name.Value]:
+				v.addf(name, "duplicate job name '%s'", name.Value)
+			}
+		}
+		names[jobs[i].Name] = true
+
+		var vmRoles map[string]bool
+		if alias := mappingValue(jobNode, "vm_alias"); alias != nil {
+			jobs[i].VMAlias = alias.Value
+			var known bool
+			if vmRoles, known = roles[alias.Value]; !known {
+				v.addf(alias, "job '%s' refers to unknown VM alias '%s'", jobs[i].Name, alias.Value)
+			}
+		}
+
+		for j, opNode := range sequenceItems(mappingValue(jobNode, "operations")) {
+			v.checkOperation(opNode, fmt.Sprintf("job '%s', operation %d", jobs[i].Name, j+1), vmRoles)
+		}
+		for _, phase := range []string{"on_failure", "on_success", "always"} {
+			for j, opNode := range sequenceItems(mappingValue(jobNode, phase)) {
+				v.checkOperation(opNode, fmt.Sprintf("job '%s', %s operation %d", jobs[i].Name, phase, j+1), vmRoles)
+			}
+		}
+	}
+
+	// Check the dependency graph once every job name is known.
+	unknownDeps := false
+	for i, jobNode := range jobNodes {
+		for _, dep := range sequenceItems(mappingValue(jobNode, "depends_on")) {
+			if !names[dep.Value] {
+				v.addf(dep, "job '%s' depends on unknown job '%s'", jobs[i].Name, dep.Value)
+				unknownDeps = true
+			}
+			jobs[i].DependsOn = append(jobs[i].DependsOn, dep.Value)
+		}
+	}
+	if !unknownDeps && len(names) == len(jobs) {
+		if _, err := JobOrder(jobs); err != nil {
+			v.addf(jobsNode, "%v", err)
+		}
+	}
+}
+
+// passwordSources are the mutually exclusive ways to give a VM user's password.
+var passwordSources = []string{"password", "password_file", "password_env", "password_command"}
+
+// checkOperation checks an operation's type, its parameters against the type's schema,
+// and, for operations that log into the guest, that its role exists on the VM.
+// vmRoles is nil if the job's VM is unknown.
+func (v *validator) checkOperation(n *yaml.Node, name string, vmRoles map[string]bool) {
+	typeNode := mappingValue(n, "type")
+	if typeNode == nil {
+		return
+	}
+	schema, known := operationSchemas[typeNode.Value]
+	if !known {
+		v.addf(typeNode, "%s: unknown operation type '%s' (expected one of: %s)",
+			name, typeNode.Value, strings.Join(sortedKeys(operationSchemas), ", "))
+		return
+	}
+	name = fmt.Sprintf("%s (%s)", name, typeNode.Value)
+
+	params := mappingValue(n, "params")
+	if params == nil || isScalar(params, "!!null") {
+		params = &yaml.Node{Kind: yaml.MappingNode, Line: n.Line, Column: n.Column}
+	}
+	if params.Kind == yaml.MappingNode {
+		v.checkFields(params, schema.params, name+" params")
+		for _, group := range schema.exclusive {
+			if given := givenKeys(params, group); len(given) > 1 {
+				v.addf(params, "%s: only one of %s may be given", name, strings.Join(group, ", "))
+			}
+		}
+		for _, group := range schema.oneOf {
+			if given := givenKeys(params, group); len(given) != 1 {
+				v.addf(params, "%s: exactly one of %s must be given", name, strings.Join(group, ", "))
+			}
+		}
+		if limit := mappingValue(params, "max_output_bytes"); limit != nil && isScalar(limit, "!!int") {
+			if count, err := strconv.Atoi(limit.Value); err == nil && count <= 0 {
+				v.addf(limit, "%s: 'max_output_bytes' must be positive", name)
+			}
+		}
+		if keep := mappingValue(mappingValue(params, "retain"), "keep"); keep != nil && isScalar(keep, "!!int") {
+			if count, err := strconv.Atoi(keep.Value); err == nil && count < 1 {
+				v.addf(keep, "%s: 'retain.keep' must be at least 1", name)
+			}
+		}
+	}
+
+	if retries := mappingValue(n, "retries"); retries != nil && isScalar(retries, "!!int") {
+		if count, err := strconv.Atoi(retries.Value); err == nil && count < 0 {
+			v.addf(retries, "%s: 'retries' must not be negative", name)
+		}
+	}
+	if when := mappingValue(n, "when"); when != nil && isScalar(when, "!!str") {
+		if _, err := conditions.Parse(when.Value); err != nil {
+			v.addf(when, "%s: invalid 'when' condition: %v", name, err)
+		}
+	}
+	for _, pattern := range sequenceItems(mappingValue(n, "retry_on")) {
+		if _, err := regexp.Compile(pattern.Value); err != nil {
+			v.addf(pattern, "%s: invalid 'retry_on' pattern: %v", name, err)
+		}
+	}
+
+	if schema.usesRole && vmRoles != nil {
+		role := "user"
+		roleNode := mappingValue(n, "role")
+		if roleNode != nil {
+			role = roleNode.Value
+		} else {
+			roleNode = typeNode
+		}
+		if !vmRoles[role] {
+			v.addf(roleNode, "%s: no user with role '%s' on this VM", name, role)
+		}
+	}
+}
+
+// givenKeys returns the keys of the group that are present in the mapping node.
+func givenKeys(n *yaml.Node, group []string) []string {
+	var given []string
+	for _, key := range group {
+		if mappingValue(n, key) != nil {
+			given = append(given, key)
+		}
+	}
+	return given
+}
+
+// containsString reports whether values contains v.
+func containsString(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a map in alphabetical order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRetainKeep(t *testing.T) {
+	tests := []struct {
+		keep    string
+		wantErr bool
+	}{
+		{keep: "1"},
+		{keep: "5"},
+		{keep: "0", wantErr: true},
+		{keep: "-2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run("keep "+tt.keep, func(t *testing.T) {
+			err := Validate([]byte(`
+vm_manager: virtualbox
+vms:
+  - alias: vm
+    vm_name: vm1
+jobs:
+  - vm_alias: vm
+    operations:
+      - type: TakeSnapshot
+        params:
+          name: nightly
+          retain:
+            prefix: nightly
+            keep: ` + tt.keep + `
+`))
+			switch {
+			case tt.wantErr && (err == nil || !strings.Contains(err.Error(), "line 14") || !strings.Contains(err.Error(), "'retain.keep' must be at least 1")):
+				t.Errorf("error = %v, want one about 'retain.keep' on line 14", err)
+			case !tt.wantErr && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -1,135 +1,500 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"vnecro/conditions"
 	"vnecro/config"
 	"vnecro/jobs"
+	"vnecro/redact"
 	"vnecro/vmOperations"
 )
 
-// ProcessJobs iterates over each job in the configuration, executing operations.
-// If an operation fails or if the user interrupts (CTRL+C), the current job is
-// considered failed, and if a rollback snapshot is specified, the VM is rolled back.
-func ProcessJobs(cfg *config.Config) {
-	// Create an instance of the VM operator.
-	var operator vmOperations.VMOperator
-	if cfg.VMManager == "virtualbox" {
-		operator = vmOperations.NewVirtualBoxOperator()
-	} else {
-		logrus.Fatalf("Unsupported VM manager: %s (only virtualbox is supported)", cfg.VMManager)
+// jobTask is a job handed to a worker, together with the pipeline it starts with.
+type jobTask struct {
+	index    int
+	pipeline map[string]string
+}
+
+// jobDone is reported by a worker once it has finished a job.
+type jobDone struct {
+	index    int
+	result   *JobResult
+	pipeline map[string]string
+}
+
+// jobRun holds the state shared by the operations of a running job.
+type jobRun struct {
+	vm       *config.VMConfig
+	pipeline map[string]string
+	operator vmOperations.VMOperator
+	// artifactsDir is the host directory that receives files copied out of the guest.
+	artifactsDir string
+	// strictTemplates makes undefined template variables fail the operation.
+	strictTemplates bool
+}
+
+// sameVMPredecessors returns, for each job, the index of the job on the same VM
+// that precedes it in the given order (or -1). A job never starts before its
+// predecessor has finished, so jobs sharing a VM do not overlap. Jobs are matched
+// by the vm_name their alias resolves to, as several aliases may name one VM.
+func sameVMPredecessors(cfg *config.Config, order []int) []int {
+	prev := make([]int, len(cfg.Jobs))
+	last := make(map[string]int)
+	for _, i := range order {
+		vmName := cfg.Jobs[i].VMAlias
+		if vmConfig, err := config.GetVMConfig(cfg.VMs, vmName); err == nil {
+			vmName = vmConfig.VMName
+		}
+		prev[i] = -1
+		if j, ok := last[vmName]; ok {
+			prev[i] = j
+		}
+		last[vmName] = i
+	}
+	return prev
+}
+
+// ProcessJobs runs the jobs in the configuration, executing their operations.
+// Jobs run in topological order of their depends_on edges, and jobs targeting
+// different VMs run concurrently on up to cfg.MaxParallel workers, while jobs
+// sharing a VM run one after another. A job whose upstream job failed or was
+// skipped is skipped as well.
+// If an operation fails or if the user interrupts (CTRL+C), the affected jobs are
+// considered failed, and if a rollback snapshot is specified, their VMs are rolled back.
+// Returns one result per job in configuration order, or an error if the configuration
+// cannot be run at all.
+func ProcessJobs(cfg *config.Config) ([]*JobResult, error) {
+	// Create an instance of the VM operator selected by vm_manager.
+	operator, err := vmOperations.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := operator.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return processJobs(cfg, operator)
+}
+
+// processJobs is ProcessJobs with the given VM operator.
+func processJobs(cfg *config.Config, operator vmOperations.VMOperator) ([]*JobResult, error) {
+	order, err := config.JobOrder(cfg.Jobs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job dependencies: %w", err)
 	}
 
-	// Pipeline to hold outputs from shell commands.
-	pipeline := make(map[string]string)
+	maxParallel := cfg.MaxParallel
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
 
-	// Variables to track the current job and VM.
-	var currentJob *config.JobConfig
-	var currentVM *config.VMConfig
+	// Artifacts of this run go to a timestamped directory, one subdirectory per job.
+	artifactsBase := cfg.ArtifactsDir
+	if artifactsBase == "" {
+		artifactsBase = "artifacts"
+	}
+	runArtifactsDir := filepath.Join(artifactsBase, time.Now().Format("20060102-150405"))
 
-	// Set up a channel to listen for CTRL+C (SIGINT).
+	// Set up a channel to listen for CTRL+C (SIGINT). The first signal cancels the
+	// run so that in-flight jobs fail and roll back; a second one exits immediately.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
+	defer signal.Stop(sigChan)
 	go func() {
 		sig := <-sigChan
-		logrus.Infof("Received signal: %v. Treating current job as failed.", sig)
-		// If a current job is in progress and a rollback is specified, trigger rollback.
-		if currentJob != nil && currentJob.RollbackOnFailure != "" && currentVM != nil {
-			err := jobs.RollbackVM(currentVM, currentJob.RollbackOnFailure, operator)
-			if err != nil {
-				logrus.Errorf("Rollback failed on VM '%s': %v", currentVM.VMName, err)
-			} else {
-				logrus.Infof("Rollback successful on VM '%s'", currentVM.VMName)
-			}
-		}
-		logrus.Warn("Program interrupted. Exiting now.")
+		logrus.Infof("Received signal: %v. Treating in-flight jobs as failed (press CTRL+C again to exit immediately).", sig)
+		cancel()
+		<-sigChan
+		logrus.Warn("Program interrupted again. Exiting now without waiting for rollback.")
 		os.Exit(1)
 	}()
 
-	// Process each job.
-	for _, job := range cfg.Jobs {
-		currentJob = &job
+	// Start the workers. Each job gets its own pipeline, seeded with the
+	// pipelines of the jobs it follows.
+	tasks := make(chan jobTask)
+	done := make(chan jobDone)
+	for workerID := 0; workerID < maxParallel; workerID++ {
+		go func() {
+			for task := range tasks {
+				result := runJob(ctx, cfg, &cfg.Jobs[task.index], task.pipeline, operator, runArtifactsDir)
+				done <- jobDone{index: task.index, result: result, pipeline: task.pipeline}
+			}
+		}()
+	}
 
-		vmConfig, err := config.GetVMConfig(cfg.VMs, job.VMAlias)
-		if err != nil {
-			logrus.Errorf("Job for VM alias '%s' failed: %v", job.VMAlias, err)
-			continue
-		}
-		currentVM = vmConfig
+	index := make(map[string]int, len(cfg.Jobs))
+	for i, job := range cfg.Jobs {
+		index[job.Name] = i
+	}
+	prev := sameVMPredecessors(cfg, order)
+	results := make([]*JobResult, len(cfg.Jobs))
+	for i := range cfg.Jobs {
+		results[i] = newJobResult(&cfg.Jobs[i], jobPending)
+	}
+	pipelines := make([]map[string]string, len(cfg.Jobs))
+	// Without any depends_on, every job sees the variables of all jobs finished
+	// before it, as when all jobs shared one pipeline.
+	shared := !hasDependencies(cfg.Jobs)
+	sharedPipeline := make(map[string]string)
+	finished := func(i int) bool { return results[i].Status != jobPending && results[i].Status != jobRunning }
+	skip := func(i int, reason error) {
+		logrus.Warnf("Skipping job '%s': %v", cfg.Jobs[i].Name, reason)
+		results[i].Status = jobSkipped
+		results[i].Err = reason
+	}
 
-		// If ensure_off is true, shut down the VM before processing operations.
-		if job.EnsureOff {
-			logrus.Infof("Ensuring VM '%s' is off", vmConfig.VMName)
-			if err := jobs.ShutdownVM(vmConfig, operator); err != nil {
-				logrus.Errorf("Failed to shut down VM '%s': %v", vmConfig.VMName, err)
+	active, remaining := 0, len(order)
+	for remaining > 0 {
+		progressed := false
+		// Walk the pending jobs in topological order, skipping those with a
+		// failed upstream job and dispatching those that are ready.
+		for _, i := range order {
+			if results[i].Status != jobPending {
 				continue
 			}
-			logrus.Infof("VM '%s' shut down successfully.", vmConfig.VMName)
-		}
-
-		// Process each operation; if one fails, mark the job as failed.
-		jobFailed := false
-		for _, op := range job.Operations {
-			var opErr error
-			switch op.Type {
-			case "RestoreSnapshot":
-				opErr = jobs.RestoreSnapshot(vmConfig, op, operator)
-			case "StartVM":
-				opErr = jobs.StartVM(vmConfig, operator)
-			case "PauseVM":
-				opErr = jobs.PauseVM(vmConfig, operator)
-			case "ShutdownVM":
-				opErr = jobs.ShutdownVM(vmConfig, operator)
-			case "ExecuteShellCommand":
-				opErr = jobs.ExecuteShellCommand(vmConfig, op, pipeline, operator)
-			case "Assert":
-				opErr = jobs.Assert(pipeline, op)
-			case "Wait":
-				// Just sleep for the specified duration ("seconds" from op.Params)
-				secondsStr, ok := op.Params["seconds"].(string)
-				if !ok || secondsStr == "" {
-					opErr = fmt.Errorf("missing 'seconds' parameter for Wait operation")
-					break
-				}
-				seconds, err := strconv.Atoi(secondsStr)
-				if err != nil {
-					opErr = fmt.Errorf("invalid 'seconds' parameter for Wait operation: %w", err)
-					break
-				}
+			job := &cfg.Jobs[i]
 
-				// Notify wait operation and actually wait for the specified duration
-				logrus.Infof("Pausing execution for %d seconds (current time: %s, resuming at: %s)",
-					seconds,
-					time.Now().Format("2006-01-02 15:04:05"),
-					time.Now().Add(time.Duration(seconds)*time.Second).Format("2006-01-02 15:04:05"))
-				time.Sleep(time.Duration(seconds) * time.Second)
+			// Once interrupted, do not start any new job.
+			if ctx.Err() != nil {
+				skip(i, fmt.Errorf("run interrupted"))
+				remaining--
+				progressed = true
+				continue
+			}
 
-			default:
-				opErr = fmt.Errorf("unknown operation type: %s", op.Type)
+			ready := prev[i] == -1 || finished(prev[i])
+			var blockedBy string
+			for _, dep := range job.DependsOn {
+				switch results[index[dep]].Status {
+				case jobFailed, jobSkipped:
+					blockedBy = dep
+				case jobSucceeded:
+				default:
+					ready = false
+				}
+			}
+			if blockedBy != "" {
+				skip(i, fmt.Errorf("upstream job '%s' did not succeed", blockedBy))
+				remaining--
+				progressed = true
+				continue
+			}
+			if !ready || active >= maxParallel {
+				continue
 			}
 
-			if opErr != nil {
-				logrus.Errorf("Operation %s failed: %v", op.Type, opErr)
-				jobFailed = true
-				// Stop processing further operations in this job.
-				break
+			pipeline := make(map[string]string)
+			if shared {
+				mergePipeline(pipeline, sharedPipeline)
 			}
+			if prev[i] != -1 {
+				mergePipeline(pipeline, pipelines[prev[i]])
+			}
+			for _, dep := range job.DependsOn {
+				mergePipeline(pipeline, pipelines[index[dep]])
+			}
+			results[i].Status = jobRunning
+			active++
+			progressed = true
+			tasks <- jobTask{index: i, pipeline: pipeline}
 		}
 
-		// If any operation failed and a rollback snapshot is specified, perform rollback.
-		if jobFailed && job.RollbackOnFailure != "" {
-			logrus.Infof("Job failed; initiating rollback on VM '%s' to snapshot '%s'",
-				vmConfig.VMName, job.RollbackOnFailure)
-			if err := jobs.RollbackVM(vmConfig, job.RollbackOnFailure, operator); err != nil {
-				logrus.Errorf("Rollback failed on VM '%s': %v", vmConfig.VMName, err)
-			} else {
-				logrus.Infof("Rollback successful on VM '%s'", vmConfig.VMName)
+		if active == 0 {
+			if !progressed {
+				return nil, fmt.Errorf("job scheduler stalled with %d job(s) left", remaining)
 			}
+			// Nothing is running, so the remaining jobs have just been skipped.
+			continue
 		}
+		finishedJob := <-done
+		active--
+		remaining--
+		pipelines[finishedJob.index] = finishedJob.pipeline
+		if shared {
+			mergePipeline(sharedPipeline, finishedJob.pipeline)
+		}
+		results[finishedJob.index] = finishedJob.result
+	}
+	close(tasks)
+
+	if ctx.Err() != nil {
+		logrus.Warn("Program interrupted.")
+	}
+	return results, nil
+}
+
+// hasDependencies reports whether any job declares depends_on.
+func hasDependencies(jobs []config.JobConfig) bool {
+	for _, job := range jobs {
+		if len(job.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mergePipeline copies every variable of src into dst.
+func mergePipeline(dst, src map[string]string) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// runJob executes the operations of a single job, rolling the VM back if an
+// operation fails and a rollback snapshot is specified. The job-level timeout,
+// if any, bounds every operation of the job, but not the rollback.
+// Returns the job's result.
+func runJob(ctx context.Context, cfg *config.Config, job *config.JobConfig, pipeline map[string]string, operator vmOperations.VMOperator, runArtifactsDir string) *JobResult {
+	result := newJobResult(job, jobSucceeded)
+	result.Started = time.Now()
+	defer func() { result.Duration = time.Since(result.Started) }()
+
+	vmConfig, err := config.GetVMConfig(cfg.VMs, job.VMAlias)
+	if err != nil {
+		logrus.Errorf("Job '%s' for VM alias '%s' failed: %v", job.Name, job.VMAlias, err)
+		result.Status, result.Err = jobFailed, err
+		return result
+	}
+	logrus.Infof("Starting job '%s' on VM '%s'", job.Name, vmConfig.VMName)
+	run := &jobRun{
+		vm:              vmConfig,
+		pipeline:        pipeline,
+		operator:        operator,
+		artifactsDir:    filepath.Join(runArtifactsDir, job.Name),
+		strictTemplates: cfg.StrictTemplates,
+	}
+
+	// Timeouts were validated when the configuration was loaded.
+	jobCtx := ctx
+	jobTimeout, _ := config.ParseTimeout(job.Timeout)
+	if jobTimeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeout(ctx, jobTimeout)
+		defer cancel()
+	}
+
+	// If ensure_off is true, shut down the VM before processing operations.
+	if job.EnsureOff {
+		logrus.Infof("Ensuring VM '%s' is off", vmConfig.VMName)
+		if err := jobs.ShutdownVM(jobCtx, vmConfig, config.Operation{Type: "ShutdownVM"}, operator); err != nil {
+			err = describeCancellation(jobCtx, jobTimeout, "job", err)
+			logrus.Errorf("Failed to shut down VM '%s': %v", vmConfig.VMName, err)
+			result.Status, result.Err, result.FailedOperationType = jobFailed, err, "ensure_off"
+			return result
+		}
+		logrus.Infof("VM '%s' shut down successfully.", vmConfig.VMName)
+	}
+
+	// Process each operation; if one fails, mark the job as failed.
+	for i, op := range job.Operations {
+		if err := runStep(jobCtx, jobTimeout, run, op, &result.Operations[i]); err != nil {
+			result.Status, result.Err = jobFailed, err
+			result.FailedOperation, result.FailedOperationType = i+1, op.Type
+			// Stop processing further operations in this job.
+			break
+		}
+	}
+
+	// Run the cleanup operations before a rollback wipes the evidence. Like the
+	// rollback, they run even if the job was cancelled or timed out.
+	cleanupCtx := context.WithoutCancel(ctx)
+	if result.Status == jobFailed {
+		runCleanup(cleanupCtx, run, "on_failure", job.OnFailure, result)
+		skipCleanup(result, "on_success", "the job failed")
+	} else {
+		skipCleanup(result, "on_failure", "the job passed")
+		runCleanup(cleanupCtx, run, "on_success", job.OnSuccess, result)
+	}
+	runCleanup(cleanupCtx, run, "always", job.Always, result)
+
+	// If any operation failed and a rollback snapshot is specified, perform rollback.
+	// The rollback must run to completion even if the job was cancelled or timed out.
+	if result.Status == jobFailed && job.RollbackOnFailure != "" {
+		logrus.Infof("Job failed; initiating rollback on VM '%s' to snapshot '%s'",
+			vmConfig.VMName, job.RollbackOnFailure)
+		if err := jobs.RollbackVM(context.WithoutCancel(ctx), vmConfig, job.RollbackOnFailure, operator); err != nil {
+			logrus.Errorf("Rollback failed on VM '%s': %v", vmConfig.VMName, err)
+			result.Rollback, result.RollbackErr = rollbackFailed, err
+		} else {
+			logrus.Infof("Rollback successful on VM '%s'", vmConfig.VMName)
+			result.Rollback = rollbackSucceeded
+		}
+	}
+	return result
+}
+
+// runStep runs one operation of a job, recording its outcome in opResult. An operation
+// whose when condition does not hold is skipped. Returns the operation's error,
+// described as a timeout or interruption of the job if it was one.
+func runStep(ctx context.Context, jobTimeout time.Duration, run *jobRun, op config.Operation, opResult *OperationResult) error {
+	if op.When != "" {
+		holds, err := conditionHolds(op.When, run.pipeline)
+		if err != nil {
+			err = fmt.Errorf("error evaluating 'when' condition: %w", err)
+			logrus.Errorf("Operation %s failed: %v", op.Type, err)
+			opResult.Status, opResult.Err = jobFailed, err
+			return err
+		}
+		if !holds {
+			logrus.Infof("Skipping operation %s: condition not met: %s", op.Type, op.When)
+			opResult.SkipReason = "condition not met: " + op.When
+			return nil
+		}
+	}
+
+	opStart := time.Now()
+	attempts, opErr := runWithRetries(ctx, run, op)
+	opResult.Duration, opResult.Attempts = time.Since(opStart), attempts
+	opResult.Status = jobSucceeded
+	if op.StoreAs != "" {
+		opResult.Output = run.pipeline[op.StoreAs]
+		if op.Sensitive {
+			redact.Add(opResult.Output)
+		}
+	}
+	if opErr != nil {
+		opErr = describeCancellation(ctx, jobTimeout, "job", opErr)
+		logrus.Errorf("Operation %s failed: %v", op.Type, opErr)
+		opResult.Status, opResult.Err = jobFailed, opErr
+	}
+	return opErr
+}
+
+// runCleanup runs the cleanup operations of one phase ("on_failure", "on_success" or
+// "always"). Unlike the job's operations, every cleanup operation runs even if an
+// earlier one failed, and failures are recorded without changing the job's status.
+func runCleanup(ctx context.Context, run *jobRun, phase string, ops []config.Operation, result *JobResult) {
+	if len(ops) == 0 {
+		return
+	}
+	logrus.Infof("Running %d %s operation(s) of job '%s'", len(ops), phase, result.Name)
+	opResults := result.phaseOperations(phase)
+	for i, op := range ops {
+		runStep(ctx, 0, run, op, &opResults[i])
+	}
+}
+
+// skipCleanup records why the cleanup operations of a phase did not run.
+func skipCleanup(result *JobResult, phase, reason string) {
+	opResults := result.phaseOperations(phase)
+	for i := range opResults {
+		opResults[i].SkipReason = reason
+	}
+}
+
+// conditionHolds evaluates an operation's when condition against the pipeline.
+func conditionHolds(when string, pipeline map[string]string) (bool, error) {
+	expr, err := conditions.Parse(when)
+	if err != nil {
+		return false, err
+	}
+	return expr.Eval(pipeline)
+}
+
+// runOperation dispatches a single operation, bounding it by the operation's timeout if set.
+func runOperation(ctx context.Context, run *jobRun, op config.Operation) error {
+	vmConfig, pipeline, operator := run.vm, run.pipeline, run.operator
+
+	// Expand pipeline variables and other template data in the parameters.
+	params, err := jobs.RenderParams(op.Params, vmConfig, pipeline, run.strictTemplates)
+	if err != nil {
+		return fmt.Errorf("error rendering parameters: %w", err)
+	}
+	op.Params = params
+	opCtx := ctx
+	opTimeout, _ := config.ParseTimeout(op.Timeout)
+	if opTimeout > 0 {
+		var cancel context.CancelFunc
+		opCtx, cancel = context.WithTimeout(ctx, opTimeout)
+		defer cancel()
+	}
+
+	var opErr error
+	switch op.Type {
+	case "RestoreSnapshot":
+		opErr = jobs.RestoreSnapshot(opCtx, vmConfig, op, operator)
+	case "TakeSnapshot":
+		opErr = jobs.TakeSnapshot(opCtx, vmConfig, op, operator)
+	case "DeleteSnapshot":
+		opErr = jobs.DeleteSnapshot(opCtx, vmConfig, op, operator)
+	case "StartVM":
+		opErr = jobs.StartVM(opCtx, vmConfig, operator)
+	case "PauseVM":
+		opErr = jobs.PauseVM(opCtx, vmConfig, operator)
+	case "ResumeVM":
+		opErr = jobs.ResumeVM(opCtx, vmConfig, operator)
+	case "ResetVM":
+		opErr = jobs.ResetVM(opCtx, vmConfig, operator)
+	case "SaveState":
+		opErr = jobs.SaveState(opCtx, vmConfig, operator)
+	case "ShutdownVM":
+		opErr = jobs.ShutdownVM(opCtx, vmConfig, op, operator)
+	case "WaitForState":
+		opErr = jobs.WaitForState(opCtx, vmConfig, op, pipeline, operator)
+	case "CopyToGuest":
+		opErr = jobs.CopyToGuest(opCtx, vmConfig, op, operator)
+	case "CopyFromGuest":
+		opErr = jobs.CopyFromGuest(opCtx, vmConfig, op, operator, run.artifactsDir)
+	case "ExecuteShellCommand":
+		opErr = jobs.ExecuteShellCommand(opCtx, vmConfig, op, pipeline, operator)
+	case "RunScript":
+		opErr = jobs.RunScript(opCtx, vmConfig, op, pipeline, operator)
+	case "Assert":
+		opErr = jobs.Assert(opCtx, pipeline, op)
+	case "Wait":
+		// Just sleep for the specified duration ("seconds" from op.Params)
+		secondsStr, ok := op.Params["seconds"].(string)
+		if !ok || secondsStr == "" {
+			opErr = fmt.Errorf("missing 'seconds' parameter for Wait operation")
+			break
+		}
+		seconds, err := strconv.Atoi(secondsStr)
+		if err != nil {
+			opErr = fmt.Errorf("invalid 'seconds' parameter for Wait operation: %w", err)
+			break
+		}
+
+		// Notify wait operation and actually wait for the specified duration
+		logrus.Infof("Pausing execution for %d seconds (current time: %s, resuming at: %s)",
+			seconds,
+			time.Now().Format("2006-01-02 15:04:05"),
+			time.Now().Add(time.Duration(seconds)*time.Second).Format("2006-01-02 15:04:05"))
+		select {
+		case <-opCtx.Done():
+			opErr = fmt.Errorf("wait interrupted: %w", opCtx.Err())
+		case <-time.After(time.Duration(seconds) * time.Second):
+		}
+
+	default:
+		opErr = fmt.Errorf("unknown operation type: %s", op.Type)
+	}
+
+	if opErr != nil && ctx.Err() == nil {
+		// Only the operation's own deadline expired.
+		return describeCancellation(opCtx, opTimeout, "operation", opErr)
+	}
+	return opErr
+}
+
+// describeCancellation explains an error caused by the given context being
+// cancelled or running past its timeout; other errors are returned unchanged.
+func describeCancellation(ctx context.Context, timeout time.Duration, scope string, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%s timed out after %s: %w", scope, timeout, err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("interrupted: %w", err)
 	}
+	return err
 }
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"vnecro/config"
+	"vnecro/vmOperations"
+	"vnecro/vmTypes"
+)
+
+// fakeVMs declares the VMs of the test configurations: "vm1" is powered off at the
+// "Base" snapshot, and "vm2" has no snapshots.
+const fakeVMs = `
+vm_manager: fake
+fake:
+  vms:
+    - vm_name: vm1
+      state: poweroff
+      snapshots:
+        - name: Base
+      current_snapshot: Base
+    - vm_name: vm2
+      state: poweroff
+  commands:
+    - command: whoami
+      stdout: "tester\n"
+    - command: "false"
+      exit_code: 1
+vms:
+  - alias: vm/1
+    vm_name: vm1
+    users:
+      - role: user
+        username: tester
+        password: secret
+  - alias: vm/2
+    vm_name: vm2
+    users:
+      - role: user
+        username: tester
+        password: secret
+`
+
+// runTestJobs loads fakeVMs followed by the given jobs and runs them on a fake operator,
+// which is returned for inspecting the VMs afterwards.
+func runTestJobs(t *testing.T, jobsYAML string) ([]*JobResult, vmOperations.VMOperator) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := fakeVMs + "artifacts_dir: " + filepath.Join(dir, "artifacts") + "\n" + jobsYAML
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operator, err := vmOperations.NewFakeOperator(cfg.Fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := processJobs(cfg, operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results, operator
+}
+
+// assertVMState fails the test unless the VM is in the given state.
+func assertVMState(t *testing.T, operator vmOperations.VMOperator, vmName string, want vmTypes.VMState) {
+	t.Helper()
+	info, err := operator.State(context.Background(), vmName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State != want {
+		t.Errorf("VM '%s' is %s, want %s", vmName, info.State, want)
+	}
+}
+
+// operationStatuses lists the statuses of a job's operations, e.g. "StartVM=passed".
+func operationStatuses(result *JobResult) []string {
+	var statuses []string
+	for _, op := range result.Operations {
+		name := op.Type
+		if op.Phase != "" {
+			name = op.Phase + " " + name
+		}
+		statuses = append(statuses, name+"="+op.Status.String())
+	}
+	return statuses
+}
+
+// assertStatuses compares the statuses of a job's operations.
+func assertStatuses(t *testing.T, result *JobResult, want ...string) {
+	t.Helper()
+	if got := operationStatuses(result); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("job '%s' operations:\n got  %v\n want %v", result.Name, got, want)
+	}
+}
+
+func TestProcessJobsSuccess(t *testing.T) {
+	results, operator := runTestJobs(t, `
+jobs:
+  - name: smoke
+    vm_alias: vm/1
+    operations:
+      - type: StartVM
+      - type: ExecuteShellCommand
+        store_as: user
+        params:
+          command: whoami
+      - type: Assert
+        params:
+          variable: user
+          operator: includes
+          expected: tester
+      - type: ShutdownVM
+`)
+	result := results[0]
+	if result.Status != jobSucceeded || result.Err != nil {
+		t.Fatalf("job status = %s (%v), want succeeded", result.Status, result.Err)
+	}
+	assertStatuses(t, result, "StartVM=passed", "ExecuteShellCommand=passed", "Assert=passed", "ShutdownVM=passed")
+	if got := result.Operations[1].Output; got != "tester\n" {
+		t.Errorf("stored output = %q", got)
+	}
+	if exitCode(results) != exitAllPassed {
+		t.Errorf("exit code = %d, want %d", exitCode(results), exitAllPassed)
+	}
+	assertVMState(t, operator, "vm1", vmTypes.StatePowerOff)
+}
+
+func TestProcessJobsFailureWithRollback(t *testing.T) {
+	results, operator := runTestJobs(t, `
+jobs:
+  - name: broken
+    vm_alias: vm/1
+    rollback_on_failure: Base
+    operations:
+      - type: StartVM
+      - type: TakeSnapshot
+        params:
+          name: Dirty
+      - type: ExecuteShellCommand
+        params:
+          command: "false"
+      - type: ShutdownVM
+`)
+	result := results[0]
+	if result.Status != jobFailed || result.FailedOperation != 3 || result.FailedOperationType != "ExecuteShellCommand" {
+		t.Fatalf("job status = %s, failed operation #%d %s, want failed at #3 ExecuteShellCommand",
+			result.Status, result.FailedOperation, result.FailedOperationType)
+	}
+	assertStatuses(t, result, "StartVM=passed", "TakeSnapshot=passed", "ExecuteShellCommand=failed", "ShutdownVM=skipped")
+	if result.Rollback != rollbackSucceeded {
+		t.Errorf("rollback = %s (%v), want succeeded", result.Rollback, result.RollbackErr)
+	}
+	if exitCode(results) != exitJobsFailed {
+		t.Errorf("exit code = %d, want %d", exitCode(results), exitJobsFailed)
+	}
+
+	// The rollback powered the VM off and restored the Base snapshot.
+	assertVMState(t, operator, "vm1", vmTypes.StatePowerOff)
+	tree, err := operator.ListSnapshots(context.Background(), "vm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := tree.Current(); current == nil || current.Name != "Base" {
+		t.Errorf("current snapshot = %v, want Base", current)
+	}
+}
+
+func TestProcessJobsSkipsDependentsOfFailedJobs(t *testing.T) {
+	results, _ := runTestJobs(t, `
+max_parallel: 2
+jobs:
+  - name: build
+    vm_alias: vm/1
+    operations:
+      - type: StartVM
+      - type: ExecuteShellCommand
+        params:
+          command: "false"
+  - name: test
+    vm_alias: vm/2
+    depends_on: [build]
+    operations:
+      - type: StartVM
+  - name: report
+    vm_alias: vm/2
+    depends_on: [test]
+    operations:
+      - type: StartVM
+  - name: independent
+    vm_alias: vm/2
+    operations:
+      - type: StartVM
+      - type: ShutdownVM
+`)
+	want := map[string]jobStatus{"build": jobFailed, "test": jobSkipped, "report": jobSkipped, "independent": jobSucceeded}
+	for _, result := range results {
+		if result.Status != want[result.Name] {
+			t.Errorf("job '%s' status = %s, want %s", result.Name, result.Status, want[result.Name])
+		}
+	}
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), "build") {
+		t.Errorf("skipped job should name the failed upstream job, got %v", results[1].Err)
+	}
+	assertStatuses(t, results[1], "StartVM=skipped")
+}
+
+func TestProcessJobsCleanupOperations(t *testing.T) {
+	results, operator := runTestJobs(t, `
+jobs:
+  - name: failing
+    vm_alias: vm/1
+    operations:
+      - type: StartVM
+      - type: ExecuteShellCommand
+        params:
+          command: "false"
+    on_failure:
+      - type: ExecuteShellCommand
+        store_as: who
+        params:
+          command: whoami
+    on_success:
+      - type: TakeSnapshot
+        params:
+          name: Good
+    always:
+      - type: ShutdownVM
+  - name: passing
+    vm_alias: vm/2
+    operations:
+      - type: StartVM
+    on_failure:
+      - type: ExecuteShellCommand
+        params:
+          command: whoami
+    always:
+      - type: ShutdownVM
+`)
+	failing, passing := results[0], results[1]
+	if failing.Status != jobFailed {
+		t.Errorf("job 'failing' status = %s, want failed", failing.Status)
+	}
+	assertStatuses(t, failing, "StartVM=passed", "ExecuteShellCommand=failed",
+		"on_failure ExecuteShellCommand=passed", "on_success TakeSnapshot=skipped", "always ShutdownVM=passed")
+	if reason := failing.Operations[3].SkipReason; !strings.Contains(reason, "failed") {
+		t.Errorf("skip reason of on_success = %q", reason)
+	}
+	assertVMState(t, operator, "vm1", vmTypes.StatePowerOff)
+
+	if passing.Status != jobSucceeded {
+		t.Errorf("job 'passing' status = %s (%v), want succeeded", passing.Status, passing.Err)
+	}
+	assertStatuses(t, passing, "StartVM=passed", "on_failure ExecuteShellCommand=skipped", "always ShutdownVM=passed")
+	assertVMState(t, operator, "vm2", vmTypes.StatePowerOff)
+}
+
+func TestProcessJobsPipelines(t *testing.T) {
+	// The second job reads a variable stored by a job on another VM.
+	jobsYAML := `
+jobs:
+  - name: first
+    vm_alias: vm/1
+    operations:
+      - type: StartVM
+      - type: ExecuteShellCommand
+        store_as: user
+        params:
+          command: whoami
+  - name: second
+    vm_alias: vm/2
+%s
+    operations:
+      - type: Assert
+        params:
+          variable: user
+          operator: includes
+          expected: tester
+`
+	tests := []struct {
+		name      string
+		dependsOn string
+		want      jobStatus
+	}{
+		// Without depends_on, jobs see the variables of all earlier jobs.
+		{name: "shared", want: jobSucceeded},
+		{name: "declared dependency", dependsOn: "    depends_on: [first]", want: jobSucceeded},
+		{name: "other dependency", dependsOn: "    depends_on: [other]", want: jobFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := fmt.Sprintf(jobsYAML, tt.dependsOn)
+			if strings.Contains(tt.dependsOn, "other") {
+				config += `
+  - name: other
+    vm_alias: vm/2
+    operations:
+      - type: StartVM
+`
+			}
+			results, _ := runTestJobs(t, config)
+			if got := results[1].Status; got != tt.want {
+				t.Errorf("job 'second' status = %s (%v), want %s", got, results[1].Err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessJobsRendersStoredOutputIntoSnapshotName(t *testing.T) {
+	results, operator := runTestJobs(t, `
+jobs:
+  - name: snapshot
+    vm_alias: vm/1
+    operations:
+      - type: StartVM
+      - type: ExecuteShellCommand
+        store_as: who
+        params:
+          command: whoami
+      - type: TakeSnapshot
+        params:
+          name: "snap-{{ .vars.who }}"
+`)
+	if results[0].Status != jobSucceeded {
+		t.Fatalf("job status = %s (%v), want succeeded", results[0].Status, results[0].Err)
+	}
+	tree, err := operator.ListSnapshots(context.Background(), "vm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := tree.Current(); current == nil || current.Name != "snap-tester" {
+		t.Errorf("current snapshot = %v, want snap-tester", current)
+	}
+}
+
+func TestSameVMPredecessorsMatchesVMName(t *testing.T) {
+	cfg := &config.Config{
+		VMs: []config.VMConfig{
+			{Alias: "vm/a", VMName: "vm1"},
+			{Alias: "vm/b", VMName: "vm1"},
+			{Alias: "vm/c", VMName: "vm2"},
+		},
+		Jobs: []config.JobConfig{
+			{Name: "first", VMAlias: "vm/a"},
+			{Name: "other", VMAlias: "vm/c"},
+			{Name: "second", VMAlias: "vm/b"},
+		},
+	}
+	// Both aliases name vm1, so "second" waits for "first".
+	prev := sameVMPredecessors(cfg, []int{0, 1, 2})
+	if want := []int{-1, -1, 0}; !slices.Equal(prev, want) {
+		t.Errorf("predecessors = %v, want %v", prev, want)
+	}
+}
@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
@@ -11,7 +12,7 @@ import (
 // Assert retrieves the variable from the pipeline and verifies it using the given operator.
 // Instead of halting execution immediately, it returns an error so that the caller (job dispatcher)
 // can decide to trigger a rollback or other recovery measures.
-func Assert(pipeline map[string]string, op config.Operation) error {
+func Assert(ctx context.Context, pipeline map[string]string, op config.Operation) error {
 	// Retrieve the variable name.
 	varName, ok := op.Params["variable"].(string)
 	if !ok || varName == "" {
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+)
+
+// CopyFromGuest copies guest files to the host as the user of the operation's role.
+// The "source" parameter is a guest path or glob (or a list of them, expanded by bash in
+// the guest), "destination" is the host directory, resolved against the job's artifacts
+// directory if relative (default: the artifacts directory itself), "recursive: true"
+// allows copying directories, and an optional octal "mode" (e.g. "0644") is applied to
+// the copied files on the host.
+// Returns an error if any step fails.
+func CopyFromGuest(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, operator vmOperations.VMOperator, artifactsDir string) error {
+	patterns, err := stringListParam(op, "source")
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		return fmt.Errorf("missing 'source' parameter for CopyFromGuest operation")
+	}
+	destination, _ := op.Params["destination"].(string)
+	if !filepath.IsAbs(destination) {
+		destination = filepath.Join(artifactsDir, destination)
+	}
+	recursive, err := boolParam(op, "recursive")
+	if err != nil {
+		return err
+	}
+	mode, err := modeParam(op)
+	if err != nil {
+		return err
+	}
+
+	credentials, err := guestCredentials(ctx, vmConfig, op, operator)
+	if err != nil {
+		return err
+	}
+
+	// Expand guest-side globs.
+	var sources []string
+	for _, pattern := range patterns {
+		matches, err := expandGuestGlob(ctx, vmConfig, credentials, operator, pattern)
+		if err != nil {
+			return fmt.Errorf("invalid 'source' parameter for CopyFromGuest operation: %w", err)
+		}
+		sources = append(sources, matches...)
+	}
+
+	if err := os.MkdirAll(destination, 0o755); err != nil {
+		return fmt.Errorf("error creating destination directory '%s': %w", destination, err)
+	}
+	logrus.Infof("Copying %d item(s) from VM '%s' to '%s'", len(sources), vmConfig.VMName, destination)
+	if err := operator.CopyFromGuest(ctx, vmConfig.VMName, credentials.Username, credentials.Password, sources, destination, recursive); err != nil {
+		return fmt.Errorf("error copying files from VM '%s': %w", vmConfig.VMName, err)
+	}
+
+	// Apply the requested permissions to the copied files.
+	if mode != "" {
+		perm, _ := strconv.ParseUint(mode, 8, 32)
+		for _, source := range sources {
+			target := filepath.Join(destination, path.Base(source))
+			err := filepath.WalkDir(target, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || !d.Type().IsRegular() {
+					return err
+				}
+				return os.Chmod(p, fs.FileMode(perm))
+			})
+			if err != nil {
+				return fmt.Errorf("error setting mode %s on '%s': %w", mode, target, err)
+			}
+		}
+	}
+	logrus.Info("Files copied successfully!")
+	return nil
+}
@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+)
+
+// CopyToGuest copies host files into a guest directory as the user of the operation's role.
+// The "source" parameter is a host path or glob (or a list of them, "**" matching any
+// number of directories), "destination" is the guest directory, "recursive: true" allows
+// copying directories, and an optional octal "mode" (e.g. "0755") is applied to the
+// copied files inside the guest.
+// Returns an error if any step fails.
+func CopyToGuest(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, operator vmOperations.VMOperator) error {
+	patterns, err := stringListParam(op, "source")
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		return fmt.Errorf("missing 'source' parameter for CopyToGuest operation")
+	}
+	destination, ok := op.Params["destination"].(string)
+	if !ok || destination == "" {
+		return fmt.Errorf("missing 'destination' parameter for CopyToGuest operation")
+	}
+	recursive, err := boolParam(op, "recursive")
+	if err != nil {
+		return err
+	}
+	mode, err := modeParam(op)
+	if err != nil {
+		return err
+	}
+
+	// Expand host-side globs.
+	var sources []string
+	for _, pattern := range patterns {
+		matches, err := expandHostGlob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid 'source' parameter for CopyToGuest operation: %w", err)
+		}
+		sources = append(sources, matches...)
+	}
+
+	credentials, err := guestCredentials(ctx, vmConfig, op, operator)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Copying %d item(s) to '%s' on VM '%s'", len(sources), destination, vmConfig.VMName)
+	if err := operator.CopyToGuest(ctx, vmConfig.VMName, credentials.Username, credentials.Password, sources, destination, recursive); err != nil {
+		return fmt.Errorf("error copying files to VM '%s': %w", vmConfig.VMName, err)
+	}
+
+	// Apply the requested permissions to the copied files.
+	if mode != "" {
+		for _, source := range sources {
+			target := path.Join(destination, filepath.Base(source))
+			if recursive {
+				_, err = runGuestCommand(ctx, vmConfig, credentials, operator, "/usr/bin/find", target, "-type", "f", "-exec", "/bin/chmod", mode, "{}", "+")
+			} else {
+				_, err = runGuestCommand(ctx, vmConfig, credentials, operator, "/bin/chmod", mode, target)
+			}
+			if err != nil {
+				return fmt.Errorf("error setting mode %s on '%s' in VM '%s': %w", mode, target, vmConfig.VMName, err)
+			}
+		}
+	}
+	logrus.Info("Files copied successfully!")
+	return nil
+}
+
+// modeParam reads the optional octal "mode" parameter, e.g. "0644".
+func modeParam(op config.Operation) (string, error) {
+	raw, exists := op.Params["mode"]
+	if !exists {
+		return "", nil
+	}
+	mode, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid 'mode' parameter for %s operation: expected a quoted octal string such as \"0644\"", op.Type)
+	}
+	if _, err := strconv.ParseUint(mode, 8, 32); err != nil {
+		return "", fmt.Errorf("invalid 'mode' parameter for %s operation: '%s' is not an octal mode", op.Type, mode)
+	}
+	return mode, nil
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+)
+
+// DeleteSnapshot deletes a snapshot of the given VM, chosen by its "snapshot" (name)
+// or "uuid" parameter.
+// Returns an error if the snapshot does not exist or cannot be deleted.
+func DeleteSnapshot(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, operator vmOperations.VMOperator) error {
+	name, _ := op.Params["snapshot"].(string)
+	uuid, _ := op.Params["uuid"].(string)
+	if (name == "") == (uuid == "") {
+		return fmt.Errorf("exactly one of 'snapshot' and 'uuid' must be given for DeleteSnapshot operation")
+	}
+
+	tree, err := operator.ListSnapshots(ctx, vmConfig.VMName)
+	if err != nil {
+		return fmt.Errorf("error listing snapshots for VM '%s': %w", vmConfig.VMName, err)
+	}
+
+	snapshot, err := selectSnapshot(tree, name, uuid, "")
+	if err != nil {
+		return fmt.Errorf("error selecting snapshot for VM '%s': %w", vmConfig.VMName, err)
+	}
+
+	logrus.Infof("Deleting snapshot '%s' (UUID: %s) of VM '%s'", snapshot.Name, snapshot.UUID, vmConfig.VMName)
+	if err := operator.DeleteSnapshot(ctx, vmConfig.VMName, snapshot.UUID); err != nil {
+		return fmt.Errorf("error deleting snapshot of VM '%s': %w", vmConfig.VMName, err)
+	}
+	logrus.Info("Snapshot deleted successfully!")
+	return nil
+}
@@ -1,35 +1,38 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"vnecro/config"
+	"vnecro/redact"
 	"vnecro/vmOperations"
+	"vnecro/vmTypes"
 )
 
 // ExecuteShellCommand executes a shell command on the given VM using the provided operator.
 // It waits for the guest execution service to be ready, retrieves the command and arguments,
 // executes the command, and optionally prints and stores the output in the pipeline.
+// With "store_as: x", stdout is stored as "x" and "x.stdout", stderr as "x.stderr", the
+// exit code as "x.exit_code", and whether output was cut off by "max_output_bytes" as
+// "x.truncated". With "print_output", the output is streamed to the log line by line.
+// The command must exit with one of the "expected_exit_codes" (default [0]) unless
+// "allow_failure" is true. "shell: sh|bash" runs the command as a shell command line,
+// "resolve: path" looks the executable up in the guest's PATH instead of /bin/, and
+// "env", "cwd" and "stdin" set the command's environment, directory and input.
 // Returns an error if any step fails.
-func ExecuteShellCommand(vmConfig *config.VMConfig, op config.Operation, pipeline map[string]string, operator vmOperations.VMOperator) error {
-	// Determine which role to use (default to "user" if not specified).
-	role := op.Role
-	if role == "" {
-		role = "user"
-	}
-	credentials, err := config.GetUserByRole(vmConfig, role)
+func ExecuteShellCommand(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, pipeline map[string]string, operator vmOperations.VMOperator) error {
+	// Resolve the role's credentials and wait for the guest execution service.
+	credentials, err := guestCredentials(ctx, vmConfig, op, operator)
 	if err != nil {
-		return fmt.Errorf("error retrieving user for role '%s': %w", role, err)
-	}
-
-	// Wait until the guest execution service is ready.
-	if err := operator.WaitForGuestExecReady(vmConfig.VMName, credentials.Username, credentials.Password, 60*time.Second); err != nil {
-		return fmt.Errorf("guest execution service not ready on VM '%s': %w", vmConfig.VMName, err)
+		return err
 	}
-	logrus.Infof("Guest execution service is ready on VM '%s'. Executing shell command...", vmConfig.VMName)
+	logrus.Infof("Executing shell command on VM '%s'...", vmConfig.VMName)
 
 	// Retrieve command from parameters.
 	cmdStr, ok := op.Params["command"].(string)
@@ -49,49 +52,151 @@ func ExecuteShellCommand(vmConfig *config.VMConfig, op config.Operation, pipelin
 		}
 	}
 
-	// Execute the shell command.
-	output, err := operator.ExecuteShellCommand(vmConfig.VMName, credentials.Username, credentials.Password, cmdStr, args...)
+	// Retrieve how and where to run the command.
+	cmd := vmTypes.GuestCommand{Command: cmdStr, Args: args}
+	cmd.Shell, _ = op.Params["shell"].(string)
+	if err := commandOptions(op, &cmd); err != nil {
+		return err
+	}
+	return runCapturedCommand(ctx, vmConfig, op, pipeline, operator, credentials, cmd)
+}
+
+// commandOptions reads the "resolve", "env" and "cwd" parameters into cmd.
+func commandOptions(op config.Operation, cmd *vmTypes.GuestCommand) error {
+	resolve, _ := op.Params["resolve"].(string)
+	cmd.SearchPath = resolve == "path"
+	cmd.Cwd, _ = op.Params["cwd"].(string)
+	if rawEnv, exists := op.Params["env"]; exists {
+		env, ok := rawEnv.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid 'env' parameter for %s: expected a mapping of variable names to values", op.Type)
+		}
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", name, env[name]))
+		}
+	}
+	return nil
+}
+
+// defaultMaxOutputBytes is how much of a command's stdout, and of its stderr, is kept
+// unless the operation sets "max_output_bytes".
+const defaultMaxOutputBytes = 10 << 20
+
+// runCapturedCommand runs cmd in the guest and handles its result for ExecuteShellCommand
+// and RunScript: it feeds it "stdin", streams the output to the log if requested, keeps at most
+// "max_output_bytes" of it, stores it under "store_as", and checks the exit code against
+// "expected_exit_codes" and "allow_failure".
+func runCapturedCommand(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, pipeline map[string]string, operator vmOperations.VMOperator, credentials *config.VMUser, cmd vmTypes.GuestCommand) error {
+	// Retrieve the accepted exit codes.
+	allowFailure, err := boolParam(op, "allow_failure")
+	if err != nil {
+		return err
+	}
+	expectedCodes := []int{0}
+	if rawCodes, exists := op.Params["expected_exit_codes"]; exists {
+		expectedCodes = nil
+		slice, ok := rawCodes.([]interface{})
+		if !ok {
+			return fmt.Errorf("invalid 'expected_exit_codes' parameter for %s: expected a list of integers", op.Type)
+		}
+		for _, item := range slice {
+			code, ok := item.(int)
+			if !ok {
+				return fmt.Errorf("invalid 'expected_exit_codes' parameter for %s: '%v' is not an integer", op.Type, item)
+			}
+			expectedCodes = append(expectedCodes, code)
+		}
+	}
+
+	// Cap the captured output, and stream it to the log line by line if requested.
+	// The output of sensitive operations is not known to the redaction layer until
+	// the command has finished, so it is never streamed.
+	cmd.MaxOutputBytes = defaultMaxOutputBytes
+	if raw, exists := op.Params["max_output_bytes"]; exists {
+		limit, ok := raw.(int)
+		if !ok || limit <= 0 {
+			return fmt.Errorf("invalid 'max_output_bytes' parameter for %s: expected a positive integer", op.Type)
+		}
+		cmd.MaxOutputBytes = limit
+	}
+	if op.PrintOutput && !op.Sensitive {
+		prefix := vmConfig.VMName + " " + op.Type
+		if op.StoreAs != "" {
+			prefix += ":" + op.StoreAs
+		}
+		cmd.OnOutput = func(stream, line string) {
+			if stream == "stderr" {
+				logrus.Infof("[%s stderr] %s", prefix, line)
+			} else {
+				logrus.Infof("[%s] %s", prefix, line)
+			}
+		}
+	}
+
+	// Upload the input to a temporary guest file and redirect the command's stdin from it,
+	// which keeps it off host command lines and works for input of any size.
+	if stdin, _ := op.Params["stdin"].(string); stdin != "" {
+		guestDir, removeGuestDir, err := guestTempDir(ctx, vmConfig, credentials, operator)
+		if err != nil {
+			return err
+		}
+		defer removeGuestDir()
+		if cmd.StdinFile, err = uploadToGuest(ctx, vmConfig, credentials, operator, guestDir, "stdin", stdin); err != nil {
+			return err
+		}
+	}
+
+	// Execute the command.
+	result, err := operator.ExecuteShellCommand(ctx, vmConfig.VMName, credentials.Username, credentials.Password, cmd)
 	if err != nil {
 		return fmt.Errorf("error executing shell command: %w", err)
 	}
+	if op.Sensitive {
+		redact.Add(result.Stdout)
+		redact.Add(result.Stderr)
+	}
 
-	// If PrintOutput is true, print a structured log.
+	// If PrintOutput is true, sum up the command after its streamed output.
 	if op.PrintOutput {
-		fullCommand := cmdStr
-		if len(args) > 0 {
-			fullCommand += " " + strings.Join(args, " ")
-		}
 		logrus.Infof("Shell command executed on VM '%s':", vmConfig.VMName)
-		logrus.Infof(" - Executed command: %s", fullCommand)
-		logrus.Infof(" - Executed command result:\n%s", boxOutput(output))
+		logrus.Infof(" - Executed command: %s", cmd)
+		logrus.Infof(" - Exit code: %d (took %s)", result.ExitCode, result.Duration.Round(time.Millisecond))
+		if op.Sensitive {
+			logrus.Infof(" - Output not printed: the operation is sensitive")
+		}
+	}
+	if result.Truncated {
+		logrus.Warnf("Output of %s on VM '%s' exceeded %d bytes and was truncated", op.Type, vmConfig.VMName, cmd.MaxOutputBytes)
 	}
 
 	// If "store_as" is specified, store the output in the pipeline.
 	if op.StoreAs != "" {
-		pipeline[op.StoreAs] = output
+		pipeline[op.StoreAs] = result.Stdout
+		pipeline[op.StoreAs+".stdout"] = result.Stdout
+		pipeline[op.StoreAs+".stderr"] = result.Stderr
+		pipeline[op.StoreAs+".exit_code"] = strconv.Itoa(result.ExitCode)
+		pipeline[op.StoreAs+".truncated"] = strconv.FormatBool(result.Truncated)
 		logrus.Infof("Stored output in variable '%s'", op.StoreAs)
 	}
 
+	if !allowFailure && !containsInt(expectedCodes, result.ExitCode) {
+		return fmt.Errorf("shell command exited with code %d (expected %v): %s",
+			result.ExitCode, expectedCodes, strings.TrimSpace(result.Stderr))
+	}
 	return nil
 }
 
-// boxOutput returns the given text surrounded by an ASCII box.
-func boxOutput(output string) string {
-	lines := strings.Split(output, "\n")
-	maxLen := 0
-	for _, line := range lines {
-		if len(line) > maxLen {
-			maxLen = len(line)
+// containsInt reports whether values contains v.
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
 		}
 	}
-
-	// Create a top and bottom border.
-	border := "+" + strings.Repeat("-", maxLen+2) + "+"
-	var sb strings.Builder
-	sb.WriteString(border + "\n")
-	for _, line := range lines {
-		sb.WriteString(fmt.Sprintf("| %-*s |\n", maxLen, line))
-	}
-	sb.WriteString(border)
-	return sb.String()
+	return false
 }
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vnecro/config"
+)
+
+func TestExecuteShellCommandStoresOutput(t *testing.T) {
+	operator := newFakeOperator(t, "running",
+		config.FakeCommand{Command: "cat /etc/hostname", Stdout: "test\n", Stderr: "note\n"})
+	pipeline := map[string]string{}
+	op := config.Operation{
+		Type:    "ExecuteShellCommand",
+		StoreAs: "host",
+		Params:  map[string]interface{}{"command": "cat", "args": []interface{}{"/etc/hostname"}},
+	}
+	if err := ExecuteShellCommand(context.Background(), testVM, op, pipeline, operator); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"host":           "test\n",
+		"host.stdout":    "test\n",
+		"host.stderr":    "note\n",
+		"host.exit_code": "0",
+		"host.truncated": "false",
+	}
+	for key, value := range want {
+		if pipeline[key] != value {
+			t.Errorf("pipeline[%q] = %q, want %q", key, pipeline[key], value)
+		}
+	}
+}
+
+func TestExecuteShellCommandExitCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{name: "non-zero exit fails", params: map[string]interface{}{}, wantErr: true},
+		{name: "expected exit code", params: map[string]interface{}{"expected_exit_codes": []interface{}{0, 3}}},
+		{name: "unexpected exit code", params: map[string]interface{}{"expected_exit_codes": []interface{}{1}}, wantErr: true},
+		{name: "allow failure", params: map[string]interface{}{"allow_failure": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operator := newFakeOperator(t, "running", config.FakeCommand{Command: "check", Stderr: "bad\n", ExitCode: 3})
+			tt.params["command"] = "check"
+			op := config.Operation{Type: "ExecuteShellCommand", StoreAs: "check", Params: tt.params}
+			pipeline := map[string]string{}
+			err := ExecuteShellCommand(context.Background(), testVM, op, pipeline, operator)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if pipeline["check.exit_code"] != "3" {
+				t.Errorf("exit code = %q, want 3", pipeline["check.exit_code"])
+			}
+		})
+	}
+}
+
+func TestExecuteShellCommandTruncatesOutput(t *testing.T) {
+	operator := newFakeOperator(t, "running",
+		config.FakeCommand{Command: "build", Stdout: strings.Repeat("x", 100)})
+	pipeline := map[string]string{}
+	op := config.Operation{
+		Type:    "ExecuteShellCommand",
+		StoreAs: "build",
+		Params:  map[string]interface{}{"command": "build", "max_output_bytes": 10},
+	}
+	if err := ExecuteShellCommand(context.Background(), testVM, op, pipeline, operator); err != nil {
+		t.Fatal(err)
+	}
+	if pipeline["build"] != strings.Repeat("x", 10) || pipeline["build.truncated"] != "true" {
+		t.Errorf("stored %q (truncated: %s), want 10 bytes, truncated", pipeline["build"], pipeline["build.truncated"])
+	}
+}
+
+func TestExecuteShellCommandNeedsRunningVM(t *testing.T) {
+	operator := newFakeOperator(t, "poweroff")
+	op := config.Operation{Type: "ExecuteShellCommand", Params: map[string]interface{}{"command": "true"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	// Do not wait a minute for the guest execution service.
+	cancel()
+	if err := ExecuteShellCommand(ctx, testVM, op, map[string]string{}, operator); err == nil {
+		t.Fatal("expected an error for a VM that is powered off")
+	}
+}
+
+func TestExecuteShellCommandUploadsStdin(t *testing.T) {
+	operator := newFakeOperator(t, "running",
+		config.FakeCommand{Command: "mktemp -d", Stdout: "/tmp/tmp.stdin\n"},
+		config.FakeCommand{Command: "rm -rf /tmp/tmp.stdin"},
+		config.FakeCommand{Command: "cat"})
+	op := config.Operation{
+		Type:   "ExecuteShellCommand",
+		Params: map[string]interface{}{"command": "cat", "stdin": "line 1\nline 2\n"},
+	}
+	if err := ExecuteShellCommand(context.Background(), testVM, op, map[string]string{}, operator); err != nil {
+		t.Fatal(err)
+	}
+
+	// The input was uploaded to the temporary guest directory.
+	dir := t.TempDir()
+	if err := operator.CopyFromGuest(context.Background(), testVM.VMName, "tester", "secret", []string{"/tmp/tmp.stdin/stdin"}, dir, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "line 1\nline 2\n" {
+		t.Errorf("uploaded stdin = %q", data)
+	}
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"testing"
+
+	"vnecro/config"
+	"vnecro/vmOperations"
+)
+
+// testVM is the VM the jobs tests run against, with a "user" and a "root" role.
+var testVM = &config.VMConfig{
+	Alias:  "vm/test",
+	VMName: "test",
+	Users: []config.VMUser{
+		{Role: "user", Username: "tester", Password: "secret"},
+		{Role: "root", Username: "root", Password: "secret"},
+	},
+}
+
+// newFakeOperator returns a fake operator whose "test" VM is in the given state and
+// answers the given scripted commands.
+func newFakeOperator(t *testing.T, state string, commands ...config.FakeCommand) vmOperations.VMOperator {
+	t.Helper()
+	return newFakeOperatorWithVM(t, config.FakeVM{State: state}, commands...)
+}
+
+// newFakeOperatorWithVM is newFakeOperator with further settings of the "test" VM,
+// such as IgnoreACPI; its VMName is filled in.
+func newFakeOperatorWithVM(t *testing.T, vm config.FakeVM, commands ...config.FakeCommand) vmOperations.VMOperator {
+	t.Helper()
+	vm.VMName = testVM.VMName
+	operator, err := vmOperations.NewFakeOperator(config.FakeConfig{
+		VMs:      []config.FakeVM{vm},
+		Commands: commands,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return operator
+}
@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"vnecro/config"
+	"vnecro/vmOperations"
+)
+
+// hasGlobMeta reports whether the path contains glob metacharacters.
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// expandHostGlob expands a host-side glob pattern into the matching paths.
+// Besides the usual *, ? and [...] patterns, "**" matches any number of directories.
+// Returns an error if nothing matches.
+func expandHostGlob(pattern string) ([]string, error) {
+	if !hasGlobMeta(pattern) {
+		return []string{pattern}, nil
+	}
+
+	var matches []string
+	if !strings.Contains(pattern, "**") {
+		var err error
+		if matches, err = filepath.Glob(pattern); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern '%s': %w", pattern, err)
+		}
+	} else {
+		pattern = filepath.Clean(pattern)
+		re, err := globToRegexp(filepath.ToSlash(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern '%s': %w", pattern, err)
+		}
+		// Walk from the longest directory prefix without metacharacters.
+		root := filepath.Dir(pattern[:strings.IndexAny(pattern, "*?[")] + "x")
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && re.MatchString(filepath.ToSlash(path)) {
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error expanding glob pattern '%s': %w", pattern, err)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match '%s'", pattern)
+	}
+	return matches, nil
+}
+
+// globToRegexp converts a slash-separated glob pattern with "**" support into a regular expression.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// guestGlobScript prints the guest paths matching the pattern given as $1, one per line.
+// $1 is left unquoted for pathname expansion, with IFS emptied so spaces in it do not split it.
+const guestGlobScript = `shopt -s globstar nullglob; IFS=; for f in $1; do printf '%s\n' "$f"; done`
+
+// expandGuestGlob expands a guest-side glob pattern by letting bash in the guest
+// (with globstar, so "**" matches any number of directories) list the matches.
+// The pattern is passed as a positional argument rather than spliced into the script,
+// and word splitting is disabled, so it is only subject to pathname expansion.
+// Returns an error if nothing matches.
+func expandGuestGlob(ctx context.Context, vmConfig *config.VMConfig, credentials *config.VMUser, operator vmOperations.VMOperator, pattern string) ([]string, error) {
+	if !hasGlobMeta(pattern) {
+		return []string{pattern}, nil
+	}
+	output, err := runGuestCommand(ctx, vmConfig, credentials, operator, "/bin/bash", "-c", guestGlobScript, "bash", pattern)
+	if err != nil {
+		return nil, fmt.Errorf("error expanding guest glob pattern '%s': %w", pattern, err)
+	}
+	var matches []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			matches = append(matches, line)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no guest files match '%s'", pattern)
+	}
+	return matches, nil
+}
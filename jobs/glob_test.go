@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"vnecro/config"
+)
+
+func TestExpandGuestGlobPassesPatternAsArgument(t *testing.T) {
+	pattern := "/var/log/my app/*.log; rm -rf ~"
+	operator := newFakeOperator(t, "running", config.FakeCommand{
+		// The pattern reaches bash as its own argument, not as part of the script.
+		Command: "/bin/bash -c " + guestGlobScript + " bash " + pattern,
+		Stdout:  "/var/log/my app/a.log\n/var/log/my app/b.log\n",
+	})
+	matches, err := expandGuestGlob(context.Background(), testVM, &testVM.Users[0], operator, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/var/log/my app/a.log", "/var/log/my app/b.log"}; !slices.Equal(matches, want) {
+		t.Errorf("matches = %q, want %q", matches, want)
+	}
+}
+
+func TestExpandGuestGlobWithoutMatches(t *testing.T) {
+	operator := newFakeOperator(t, "running", config.FakeCommand{Command: "/bin/bash -c " + guestGlobScript + " bash /tmp/*.none"})
+	if _, err := expandGuestGlob(context.Background(), testVM, &testVM.Users[0], operator, "/tmp/*.none"); err == nil {
+		t.Fatal("expected an error when nothing matches")
+	}
+}
@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+	"vnecro/vmTypes"
+)
+
+// guestCredentials resolves the credentials for the operation's role (default "user")
+// and waits until the guest execution service accepts them.
+func guestCredentials(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, operator vmOperations.VMOperator) (*config.VMUser, error) {
+	// Determine which role to use (default to "user" if not specified).
+	role := op.Role
+	if role == "" {
+		role = "user"
+	}
+	credentials, err := config.GetUserByRole(vmConfig, role)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving user for role '%s': %w", role, err)
+	}
+	if err := credentials.ResolvePassword(); err != nil {
+		return nil, fmt.Errorf("error resolving the password of role '%s' on VM '%s': %w", role, vmConfig.Alias, err)
+	}
+
+	// Wait until the guest execution service is ready.
+	if err := operator.WaitForGuestExecReady(ctx, vmConfig.VMName, credentials.Username, credentials.Password, 60*time.Second); err != nil {
+		return nil, fmt.Errorf("guest execution service not ready on VM '%s': %w", vmConfig.VMName, err)
+	}
+	logrus.Infof("Guest execution service is ready on VM '%s'.", vmConfig.VMName)
+	return credentials, nil
+}
+
+// runGuestCommand runs a helper command in the guest and fails unless it exits with 0.
+func runGuestCommand(ctx context.Context, vmConfig *config.VMConfig, credentials *config.VMUser, operator vmOperations.VMOperator, command string, args ...string) (string, error) {
+	cmd := vmTypes.GuestCommand{Command: command, Args: args}
+	result, err := operator.ExecuteShellCommand(ctx, vmConfig.VMName, credentials.Username, credentials.Password, cmd)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("'%s' exited with code %d: %s", command, result.ExitCode, result.Stderr)
+	}
+	return result.Stdout, nil
+}
+
+// guestTempDir creates a temporary directory in the guest. The returned function removes
+// it again, even if ctx has been cancelled in the meantime.
+func guestTempDir(ctx context.Context, vmConfig *config.VMConfig, credentials *config.VMUser, operator vmOperations.VMOperator) (string, func(), error) {
+	output, err := runGuestCommand(ctx, vmConfig, credentials, operator, "mktemp", "-d")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating a temporary directory in VM '%s': %w", vmConfig.VMName, err)
+	}
+	dir := strings.TrimSpace(output)
+	remove := func() {
+		if _, err := runGuestCommand(context.WithoutCancel(ctx), vmConfig, credentials, operator, "rm", "-rf", dir); err != nil {
+			logrus.Warnf("Failed to remove '%s' from VM '%s': %v", dir, vmConfig.VMName, err)
+		}
+	}
+	return dir, remove, nil
+}
+
+// uploadToGuest writes content to the file name in the guest directory dir and returns
+// the file's guest path. The content is staged in a host file readable only by the
+// current user, which is removed afterwards.
+func uploadToGuest(ctx context.Context, vmConfig *config.VMConfig, credentials *config.VMUser, operator vmOperations.VMOperator, dir, name, content string) (string, error) {
+	hostDir, err := os.MkdirTemp("", "vnecro-upload-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating staging directory: %w", err)
+	}
+	defer os.RemoveAll(hostDir)
+	hostFile := filepath.Join(hostDir, name)
+	if err := os.WriteFile(hostFile, []byte(content), 0o600); err != nil {
+		return "", fmt.Errorf("error writing '%s': %w", hostFile, err)
+	}
+	if err := operator.CopyToGuest(ctx, vmConfig.VMName, credentials.Username, credentials.Password, []string{hostFile}, dir, false); err != nil {
+		return "", fmt.Errorf("error copying '%s' to VM '%s': %w", name, vmConfig.VMName, err)
+	}
+	return path.Join(dir, name), nil
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"fmt"
+
+	"vnecro/config"
+)
+
+// stringListParam reads a parameter given either as a single string or as a list of strings.
+// A missing parameter yields nil.
+func stringListParam(op config.Operation, key string) ([]string, error) {
+	raw, exists := op.Params[key]
+	if !exists {
+		return nil, nil
+	}
+	switch val := raw.(type) {
+	case string:
+		return []string{val}, nil
+	case []interface{}:
+		var list []string
+		for _, item := range val {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid '%s' parameter for %s operation: '%v' is not a string", key, op.Type, item)
+			}
+			list = append(list, str)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("invalid '%s' parameter for %s operation: expected a string or a list of strings", key, op.Type)
+	}
+}
+
+// boolParam reads an optional boolean parameter, defaulting to false.
+func boolParam(op config.Operation, key string) (bool, error) {
+	raw, exists := op.Params[key]
+	if !exists {
+		return false, nil
+	}
+	val, ok := raw.(bool)
+	if !ok {
+		return false, fmt.Errorf("invalid '%s' parameter for %s operation: expected true or false", key, op.Type)
+	}
+	return val, nil
+}
@@ -1,18 +1,29 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
 	"vnecro/config"
 	"vnecro/vmOperations"
+	"vnecro/vmTypes"
 )
 
 // PauseVM pauses the virtual machine specified in vmConfig using the provided operator.
+// A VM that is already paused is left as it is.
 // It returns an error if the operation fails.
-func PauseVM(vmConfig *config.VMConfig, operator vmOperations.VMOperator) error {
+func PauseVM(ctx context.Context, vmConfig *config.VMConfig, operator vmOperations.VMOperator) error {
+	info, err := operator.State(ctx, vmConfig.VMName)
+	if err != nil {
+		return fmt.Errorf("error querying state of VM '%s': %w", vmConfig.VMName, err)
+	}
+	if info.State == vmTypes.StatePaused {
+		logrus.Infof("VM '%s' is already paused", vmConfig.VMName)
+		return nil
+	}
 	logrus.Infof("Pausing VM '%s'", vmConfig.VMName)
-	if err := operator.Pause(vmConfig.VMName); err != nil {
+	if err := operator.Pause(ctx, vmConfig.VMName); err != nil {
 		return fmt.Errorf("error pausing VM '%s': %w", vmConfig.VMName, err)
 	}
 	logrus.Info("VM paused successfully!")
@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+)
+
+// ResetVM resets the running virtual machine specified in vmConfig using the provided operator,
+// rebooting the guest without shutting it down cleanly.
+// It returns an error if the operation fails.
+func ResetVM(ctx context.Context, vmConfig *config.VMConfig, operator vmOperations.VMOperator) error {
+	logrus.Infof("Resetting VM '%s'", vmConfig.VMName)
+	if err := operator.Reset(ctx, vmConfig.VMName); err != nil {
+		return fmt.Errorf("error resetting VM '%s': %w", vmConfig.VMName, err)
+	}
+	logrus.Info("VM reset successfully!")
+	return nil
+}
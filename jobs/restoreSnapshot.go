@@ -1,39 +1,90 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
 	"vnecro/config"
 	"vnecro/vmOperations"
+	"vnecro/vmTypes"
 )
 
 // RestoreSnapshot restores the given VM to a specified snapshot.
-// It first lists the snapshots, then either uses the provided snapshot name or parses the first available one.
+// The snapshot is chosen by exactly one of the "snapshot" (name), "uuid" or "target"
+// ("current" or "latest") parameters; without any of them the current snapshot is restored.
 // Returns an error if any step fails.
-func RestoreSnapshot(vmConfig *config.VMConfig, op config.Operation, operator vmOperations.VMOperator) error {
+func RestoreSnapshot(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, operator vmOperations.VMOperator) error {
 	logrus.Infof("Listing snapshots for VM '%s'", vmConfig.VMName)
-	output, err := operator.ListSnapshots(vmConfig.VMName)
+	tree, err := operator.ListSnapshots(ctx, vmConfig.VMName)
 	if err != nil {
 		return fmt.Errorf("error listing snapshots for VM '%s': %w", vmConfig.VMName, err)
 	}
-	logrus.Info("Snapshot list output:")
-	logrus.Info(output)
+	logrus.Info("Snapshot tree:")
+	logrus.Info(tree.String())
 
-	var snapshotToRestore string
-	if val, ok := op.Params["snapshot"].(string); ok && val != "" {
-		snapshotToRestore = val
-	}
-	if snapshotToRestore == "" {
-		snapshotToRestore, err = operator.ParseSnapshot(output)
-		if err != nil {
-			return fmt.Errorf("error parsing snapshot for VM '%s': %w", vmConfig.VMName, err)
-		}
+	name, _ := op.Params["snapshot"].(string)
+	uuid, _ := op.Params["uuid"].(string)
+	target, _ := op.Params["target"].(string)
+	snapshot, err := selectSnapshot(tree, name, uuid, target)
+	if err != nil {
+		return fmt.Errorf("error selecting snapshot for VM '%s': %w", vmConfig.VMName, err)
 	}
-	logrus.Infof("Restoring VM '%s' to snapshot '%s'", vmConfig.VMName, snapshotToRestore)
-	if err := operator.RestoreSnapshot(vmConfig.VMName, snapshotToRestore); err != nil {
+	logrus.Infof("Restoring VM '%s' to snapshot '%s' (UUID: %s)", vmConfig.VMName, snapshot.Name, snapshot.UUID)
+	if err := operator.RestoreSnapshot(ctx, vmConfig.VMName, snapshot.UUID); err != nil {
 		return fmt.Errorf("error restoring snapshot for VM '%s': %w", vmConfig.VMName, err)
 	}
 	logrus.Info("Snapshot restored successfully!")
 	return nil
 }
+
+// selectSnapshot picks a snapshot from the tree by name, by UUID or by target
+// ("current" or "latest"); at most one of them may be non-empty, and the current
+// snapshot is picked if all are empty.
+func selectSnapshot(tree *vmTypes.SnapshotTree, name, uuid, target string) (*vmTypes.Snapshot, error) {
+	given := 0
+	for _, v := range []string{name, uuid, target} {
+		if v != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return nil, fmt.Errorf("only one of 'snapshot', 'uuid' and 'target' may be given")
+	}
+
+	switch {
+	case name != "":
+		matches := tree.FindByName(name)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no snapshot named '%s'", name)
+		}
+		if len(matches) > 1 {
+			logrus.Warnf("%d snapshots are named '%s'; using the first one (UUID: %s)", len(matches), name, matches[0].UUID)
+		}
+		return matches[0], nil
+
+	case uuid != "":
+		snapshot := tree.FindByUUID(uuid)
+		if snapshot == nil {
+			return nil, fmt.Errorf("no snapshot with UUID '%s'", uuid)
+		}
+		return snapshot, nil
+
+	case target == "" || target == "current":
+		snapshot := tree.Current()
+		if snapshot == nil {
+			return nil, fmt.Errorf("VM has no current snapshot")
+		}
+		return snapshot, nil
+
+	case target == "latest":
+		snapshot := tree.Latest()
+		if snapshot == nil {
+			return nil, fmt.Errorf("VM has no snapshots")
+		}
+		return snapshot, nil
+
+	default:
+		return nil, fmt.Errorf("unknown target '%s', only support 'current', 'latest'", target)
+	}
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+	"vnecro/vmTypes"
+)
+
+// ResumeVM resumes the paused virtual machine specified in vmConfig using the provided operator.
+// A VM that is already running is left as it is.
+// It returns an error if the operation fails.
+func ResumeVM(ctx context.Context, vmConfig *config.VMConfig, operator vmOperations.VMOperator) error {
+	info, err := operator.State(ctx, vmConfig.VMName)
+	if err != nil {
+		return fmt.Errorf("error querying state of VM '%s': %w", vmConfig.VMName, err)
+	}
+	if info.State == vmTypes.StateRunning {
+		logrus.Infof("VM '%s' is already running", vmConfig.VMName)
+		return nil
+	}
+	logrus.Infof("Resuming VM '%s'", vmConfig.VMName)
+	if err := operator.Resume(ctx, vmConfig.VMName); err != nil {
+		return fmt.Errorf("error resuming VM '%s': %w", vmConfig.VMName, err)
+	}
+	logrus.Info("VM resumed successfully!")
+	return nil
+}
@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
@@ -11,16 +12,16 @@ import (
 // RollbackVM attempts to roll back the given VM to the specified snapshot.
 // It first attempts to shut down the VM (logging a warning if that fails) and then
 // restores the snapshot. Returns an error if the rollback fails.
-func RollbackVM(vmConfig *config.VMConfig, rollbackSnapshot string, operator vmOperations.VMOperator) error {
+func RollbackVM(ctx context.Context, vmConfig *config.VMConfig, rollbackSnapshot string, operator vmOperations.VMOperator) error {
 	logrus.Infof("Rolling back VM '%s' to snapshot '%s'", vmConfig.VMName, rollbackSnapshot)
 
 	// Attempt to shut down the VM; if shutdown fails, log a warning and continue.
-	if err := operator.Shutdown(vmConfig.VMName); err != nil {
+	if err := operator.Shutdown(ctx, vmConfig.VMName); err != nil {
 		logrus.Warnf("Error shutting down VM '%s' during rollback: %v", vmConfig.VMName, err)
 	}
 
 	// Use the VirtualBox-specific rollback function from vmOperations.
-	if err := operator.Rollback(vmConfig.VMName, rollbackSnapshot); err != nil {
+	if err := operator.Rollback(ctx, vmConfig.VMName, rollbackSnapshot); err != nil {
 		return fmt.Errorf("rollback failed: error restoring snapshot '%s' on VM '%s': %w", rollbackSnapshot, vmConfig.VMName, err)
 	}
 
@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+	"vnecro/vmTypes"
+)
+
+// RunScript copies a script into a temporary guest directory as the user of the operation's
+// role, makes it executable, runs it and removes it again. The script is either the host file
+// given by "path" or the inline "script" parameter. It is run with "interpreter" if given,
+// directly if it starts with a "#!" line, and with sh otherwise; "args" are passed to it.
+// Its output is handled like ExecuteShellCommand's, including "store_as", "expected_exit_codes",
+// "allow_failure", "resolve", "env", "cwd" and "stdin".
+// Returns an error if any step fails.
+func RunScript(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, pipeline map[string]string, operator vmOperations.VMOperator) error {
+	scriptPath, _ := op.Params["path"].(string)
+	inline, _ := op.Params["script"].(string)
+	if (scriptPath == "") == (inline == "") {
+		return fmt.Errorf("RunScript operation needs exactly one of the 'path' and 'script' parameters")
+	}
+	args, err := stringListParam(op, "args")
+	if err != nil {
+		return err
+	}
+	interpreter, _ := op.Params["interpreter"].(string)
+
+	// A script file is uploaded under its own name, an inline script as "script".
+	content, name := inline, "script"
+	if scriptPath != "" {
+		data, err := os.ReadFile(scriptPath)
+		if err != nil {
+			return fmt.Errorf("error reading script: %w", err)
+		}
+		content, name = string(data), filepath.Base(scriptPath)
+	}
+
+	credentials, err := guestCredentials(ctx, vmConfig, op, operator)
+	if err != nil {
+		return err
+	}
+
+	// Copy the script into a fresh temporary directory in the guest.
+	guestDir, removeGuestDir, err := guestTempDir(ctx, vmConfig, credentials, operator)
+	if err != nil {
+		return err
+	}
+	defer removeGuestDir()
+	guestScript, err := uploadToGuest(ctx, vmConfig, credentials, operator, guestDir, name, content)
+	if err != nil {
+		return err
+	}
+	if _, err := runGuestCommand(ctx, vmConfig, credentials, operator, "chmod", "0700", guestScript); err != nil {
+		return fmt.Errorf("error making '%s' executable in VM '%s': %w", guestScript, vmConfig.VMName, err)
+	}
+
+	// Pick how to run the script.
+	var cmd vmTypes.GuestCommand
+	switch {
+	case interpreter != "":
+		cmd = vmTypes.GuestCommand{Command: interpreter, Args: append([]string{guestScript}, args...)}
+	case strings.HasPrefix(content, "#!"):
+		cmd = vmTypes.GuestCommand{Command: guestScript, Args: args}
+	default:
+		cmd = vmTypes.GuestCommand{Command: "sh", Args: append([]string{guestScript}, args...)}
+	}
+	if err := commandOptions(op, &cmd); err != nil {
+		return err
+	}
+
+	logrus.Infof("Running script '%s' on VM '%s'...", guestScript, vmConfig.VMName)
+	return runCapturedCommand(ctx, vmConfig, op, pipeline, operator, credentials, cmd)
+}
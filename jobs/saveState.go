@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+	"vnecro/vmTypes"
+)
+
+// SaveState saves the state of the virtual machine specified in vmConfig using the provided
+// operator, stopping it; StartVM later resumes it from that state.
+// A VM whose state is already saved is left as it is.
+// It returns an error if the operation fails.
+func SaveState(ctx context.Context, vmConfig *config.VMConfig, operator vmOperations.VMOperator) error {
+	info, err := operator.State(ctx, vmConfig.VMName)
+	if err != nil {
+		return fmt.Errorf("error querying state of VM '%s': %w", vmConfig.VMName, err)
+	}
+	if info.State == vmTypes.StateSaved {
+		logrus.Infof("The state of VM '%s' is already saved", vmConfig.VMName)
+		return nil
+	}
+	logrus.Infof("Saving the state of VM '%s'", vmConfig.VMName)
+	if err := operator.SaveState(ctx, vmConfig.VMName); err != nil {
+		return fmt.Errorf("error saving state of VM '%s': %w", vmConfig.VMName, err)
+	}
+	logrus.Info("VM state saved successfully!")
+	return nil
+}
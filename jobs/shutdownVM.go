@@ -1,20 +1,97 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"vnecro/config"
 	"vnecro/vmOperations"
+	"vnecro/vmTypes"
 )
 
+// defaultShutdownGracePeriod is how long an ACPI shutdown may take before the VM is powered off.
+const defaultShutdownGracePeriod = 60 * time.Second
+
 // ShutdownVM shuts down the VM specified in vmConfig using the provided operator.
+// The "mode" parameter selects how: "poweroff" (default) cuts the power, "savestate"
+// saves the VM's state, and "acpi" presses the ACPI power button and waits for the guest
+// to shut down, powering the VM off if it is still running after the "grace_period"
+// parameter (default 60s).
+// A VM that is already off (powered off, saved or aborted) is left as it is.
 // Returns an error if the shutdown fails.
-func ShutdownVM(vmConfig *config.VMConfig, operator vmOperations.VMOperator) error {
-	logrus.Infof("Shutting down VM '%s'", vmConfig.VMName)
-	if err := operator.Shutdown(vmConfig.VMName); err != nil {
+func ShutdownVM(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, operator vmOperations.VMOperator) error {
+	mode, _ := op.Params["mode"].(string)
+	if mode == "" {
+		mode = "poweroff"
+	}
+	grace := defaultShutdownGracePeriod
+	if raw, ok := op.Params["grace_period"]; ok {
+		var err error
+		if grace, err = config.ParseTimeout(fmt.Sprint(raw)); err != nil {
+			return fmt.Errorf("invalid 'grace_period' parameter for ShutdownVM operation: %w", err)
+		}
+	}
+
+	info, err := operator.State(ctx, vmConfig.VMName)
+	if err != nil {
+		return fmt.Errorf("error querying state of VM '%s': %w", vmConfig.VMName, err)
+	}
+	if info.State.IsOff() {
+		logrus.Infof("VM '%s' is already off (%s)", vmConfig.VMName, info.State)
+		return nil
+	}
+
+	switch mode {
+	case "poweroff":
+		logrus.Infof("Shutting down VM '%s'", vmConfig.VMName)
+		err = operator.Shutdown(ctx, vmConfig.VMName)
+	case "savestate":
+		logrus.Infof("Saving the state of VM '%s'", vmConfig.VMName)
+		err = operator.SaveState(ctx, vmConfig.VMName)
+	case "acpi":
+		err = acpiShutdown(ctx, vmConfig, info.State, grace, operator)
+	default:
+		return fmt.Errorf("invalid 'mode' parameter for ShutdownVM operation: '%s'", mode)
+	}
+	if err != nil {
 		return fmt.Errorf("error shutting down VM '%s': %w", vmConfig.VMName, err)
 	}
 	logrus.Info("VM shut down successfully!")
 	return nil
 }
+
+// acpiShutdown presses the VM's ACPI power button and polls its state until it is off.
+// If the guest has not shut down after the grace period, the VM is powered off.
+// A paused guest cannot react to the power button, so it is powered off right away.
+func acpiShutdown(ctx context.Context, vmConfig *config.VMConfig, state vmTypes.VMState, grace time.Duration, operator vmOperations.VMOperator) error {
+	if state == vmTypes.StatePaused {
+		logrus.Warnf("VM '%s' is paused and cannot handle an ACPI shutdown; powering it off", vmConfig.VMName)
+		return operator.Shutdown(ctx, vmConfig.VMName)
+	}
+
+	logrus.Infof("Sending ACPI shutdown to VM '%s' (grace period: %s)", vmConfig.VMName, grace)
+	if err := operator.ACPIShutdown(ctx, vmConfig.VMName); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for ACPI shutdown: %w", ctx.Err())
+		case <-time.After(time.Second):
+		}
+		info, err := operator.State(ctx, vmConfig.VMName)
+		if err != nil {
+			return err
+		}
+		if info.State.IsOff() {
+			return nil
+		}
+		logrus.Debugf("VM '%s' is still %s after ACPI shutdown", vmConfig.VMName, info.State)
+	}
+
+	logrus.Warnf("VM '%s' did not shut down within %s; powering it off", vmConfig.VMName, grace)
+	return operator.Shutdown(ctx, vmConfig.VMName)
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"vnecro/config"
+	"vnecro/vmTypes"
+)
+
+func TestShutdownVMModes(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		ignoreACPI bool
+		start      string
+		want       vmTypes.VMState
+	}{
+		{name: "poweroff", mode: "poweroff", start: "running", want: vmTypes.StatePowerOff},
+		{name: "savestate", mode: "savestate", start: "running", want: vmTypes.StateSaved},
+		{name: "acpi", mode: "acpi", start: "running", want: vmTypes.StatePowerOff},
+		// A guest ignoring the power button is powered off after the grace period.
+		{name: "acpi ignored", mode: "acpi", ignoreACPI: true, start: "running", want: vmTypes.StatePowerOff},
+		// A paused VM cannot react to the power button, so it is powered off.
+		{name: "acpi paused", mode: "acpi", start: "paused", want: vmTypes.StatePowerOff},
+		// A VM that is already off is left alone.
+		{name: "already saved", mode: "poweroff", start: "saved", want: vmTypes.StateSaved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operator := newFakeOperatorWithVM(t, config.FakeVM{State: tt.start, IgnoreACPI: tt.ignoreACPI})
+			op := config.Operation{Type: "ShutdownVM", Params: map[string]interface{}{"mode": tt.mode, "grace_period": "1s"}}
+			if err := ShutdownVM(context.Background(), testVM, op, operator); err != nil {
+				t.Fatal(err)
+			}
+			info, err := operator.State(context.Background(), testVM.VMName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.State != tt.want {
+				t.Errorf("VM is %s, want %s", info.State, tt.want)
+			}
+		})
+	}
+}
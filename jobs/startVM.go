@@ -1,18 +1,29 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
 	"vnecro/config"
 	"vnecro/vmOperations"
+	"vnecro/vmTypes"
 )
 
 // StartVM starts the VM specified in vmConfig using the provided operator.
+// A VM that is already running is left as it is.
 // Returns an error if starting the VM fails.
-func StartVM(vmConfig *config.VMConfig, operator vmOperations.VMOperator) error {
+func StartVM(ctx context.Context, vmConfig *config.VMConfig, operator vmOperations.VMOperator) error {
+	info, err := operator.State(ctx, vmConfig.VMName)
+	if err != nil {
+		return fmt.Errorf("error querying state of VM '%s': %w", vmConfig.VMName, err)
+	}
+	if info.State == vmTypes.StateRunning {
+		logrus.Infof("VM '%s' is already running", vmConfig.VMName)
+		return nil
+	}
 	logrus.Infof("Starting VM '%s'", vmConfig.VMName)
-	if err := operator.Start(vmConfig.VMName); err != nil {
+	if err := operator.Start(ctx, vmConfig.VMName); err != nil {
 		return fmt.Errorf("error starting VM '%s': %w", vmConfig.VMName, err)
 	}
 	logrus.Info("VM started successfully!")
@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+	"vnecro/vmTypes"
+)
+
+// TakeSnapshot takes a snapshot of the given VM named by the "name" parameter, with an
+// optional "description"; "live: true" snapshots a running VM without pausing it.
+// An optional "retain" parameter ({prefix, keep}) then deletes the oldest snapshots
+// whose names start with prefix, keeping the newest keep of them.
+// Returns an error if any step fails.
+func TakeSnapshot(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, operator vmOperations.VMOperator) error {
+	name, ok := op.Params["name"].(string)
+	if !ok || name == "" {
+		return fmt.Errorf("missing 'name' parameter for TakeSnapshot operation")
+	}
+	description, _ := op.Params["description"].(string)
+
+	live, err := boolParam(op, "live")
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Taking snapshot '%s' of VM '%s'", name, vmConfig.VMName)
+	if err := operator.TakeSnapshot(ctx, vmConfig.VMName, name, description, live); err != nil {
+		return fmt.Errorf("error taking snapshot of VM '%s': %w", vmConfig.VMName, err)
+	}
+	logrus.Info("Snapshot taken successfully!")
+
+	if rawRetain, exists := op.Params["retain"]; exists {
+		retain, ok := rawRetain.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid 'retain' parameter for TakeSnapshot operation: expected a mapping with 'prefix' and 'keep'")
+		}
+		prefix, ok := retain["prefix"].(string)
+		if !ok || prefix == "" {
+			return fmt.Errorf("missing 'retain.prefix' parameter for TakeSnapshot operation")
+		}
+		keep, ok := retain["keep"].(int)
+		if !ok || keep < 1 {
+			return fmt.Errorf("invalid 'retain.keep' parameter for TakeSnapshot operation: expected a positive integer")
+		}
+		if err := pruneSnapshots(ctx, vmConfig, operator, prefix, keep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneSnapshots deletes the oldest snapshots whose names start with prefix,
+// keeping the newest keep of them. Snapshots without a timestamp are ordered
+// by their position in the snapshot tree.
+func pruneSnapshots(ctx context.Context, vmConfig *config.VMConfig, operator vmOperations.VMOperator, prefix string, keep int) error {
+	tree, err := operator.ListSnapshots(ctx, vmConfig.VMName)
+	if err != nil {
+		return fmt.Errorf("error listing snapshots for VM '%s': %w", vmConfig.VMName, err)
+	}
+
+	var matching []*vmTypes.Snapshot
+	for _, s := range tree.All() {
+		if strings.HasPrefix(s.Name, prefix) {
+			matching = append(matching, s)
+		}
+	}
+	if len(matching) <= keep {
+		return nil
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].TimeStamp.Before(matching[j].TimeStamp)
+	})
+
+	for _, s := range matching[:len(matching)-keep] {
+		logrus.Infof("Deleting snapshot '%s' (UUID: %s) of VM '%s' (retaining %d with prefix '%s')",
+			s.Name, s.UUID, vmConfig.VMName, keep, prefix)
+		if err := operator.DeleteSnapshot(ctx, vmConfig.VMName, s.UUID); err != nil {
+			return fmt.Errorf("error pruning snapshot '%s' of VM '%s': %w", s.Name, vmConfig.VMName, err)
+		}
+	}
+	return nil
+}
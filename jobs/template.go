@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"vnecro/config"
+)
+
+// RenderParams returns a copy of params in which every string value, including those
+// nested in lists and mappings, is expanded as a Go text/template. Templates can use:
+//
+//	{{ .vars.real_username }}   pipeline variables stored via store_as
+//	{{ var "out.exit_code" }}   pipeline variables whose names contain dots
+//	{{ .vm.name }}              the VM's vm_name (and {{ .vm.alias }})
+//	{{ .env.HOME }}             host environment variables
+//	{{ now }}, {{ timestamp }}  the current time, as a time.Time or as 20240131-235959
+//	{{ "{{" }}                  a literal "{{", e.g. in docker's --format '{{ "{{" }}.State.Status}}'
+//
+// Trailing whitespace of variables, such as the final newline of command output, is dropped.
+// In strict mode an undefined variable fails the rendering; otherwise it expands to "".
+func RenderParams(params map[string]interface{}, vmConfig *config.VMConfig, pipeline map[string]string, strict bool) (map[string]interface{}, error) {
+	r := newTemplateRenderer(vmConfig, pipeline, strict)
+	rendered, err := r.renderValue(params)
+	if err != nil {
+		return nil, err
+	}
+	if rendered == nil {
+		return nil, nil
+	}
+	return rendered.(map[string]interface{}), nil
+}
+
+// templateRenderer expands templates against one set of template data.
+type templateRenderer struct {
+	data   map[string]interface{}
+	funcs  template.FuncMap
+	strict bool
+}
+
+// newTemplateRenderer prepares the template data and helper functions.
+func newTemplateRenderer(vmConfig *config.VMConfig, pipeline map[string]string, strict bool) *templateRenderer {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	vm := map[string]string{"name": vmConfig.VMName, "alias": vmConfig.Alias}
+	vars := make(map[string]string, len(pipeline))
+	for k, v := range pipeline {
+		vars[k] = strings.TrimRightFunc(v, unicode.IsSpace)
+	}
+
+	return &templateRenderer{
+		data:   map[string]interface{}{"vars": vars, "vm": vm, "env": env},
+		strict: strict,
+		funcs: template.FuncMap{
+			"now":       time.Now,
+			"timestamp": func() string { return time.Now().Format("20060102-150405") },
+			"var": func(name string) (string, error) {
+				value, ok := vars[name]
+				if !ok && strict {
+					return "", fmt.Errorf("variable '%s' is not defined", name)
+				}
+				return value, nil
+			},
+		},
+	}
+}
+
+// renderValue walks a parameter value and expands every string in it.
+func (r *templateRenderer) renderValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return r.renderString(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := r.renderValue(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case map[string]interface{}:
+		if v == nil {
+			return nil, nil
+		}
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := r.renderValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("parameter '%s': %w", key, err)
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+// renderString expands a single template. Strings without template actions are returned unchanged.
+func (r *templateRenderer) renderString(text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	missingKey := "missingkey=zero"
+	if r.strict {
+		missingKey = "missingkey=error"
+	}
+	tmpl, err := template.New("param").Funcs(r.funcs).Option(missingKey).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template '%s' (write {{ \"{{\" }} for a literal \"{{\"): %w", text, err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, r.data); err != nil {
+		return "", fmt.Errorf("error rendering template '%s': %w", text, err)
+	}
+	return sb.String(), nil
+}
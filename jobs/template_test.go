@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderParamsTrimsStoredOutput(t *testing.T) {
+	pipeline := map[string]string{"who": "tester\n", "out.exit_code": "0\r\n", "indent": "  x  \n"}
+	params := map[string]interface{}{
+		"name": "snap-{{ .vars.who }}",
+		"args": []interface{}{"--user={{ var \"who\" }}", "{{ var \"out.exit_code\" }}", "[{{ .vars.indent }}]"},
+	}
+	rendered, err := RenderParams(params, testVM, pipeline, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rendered["name"]; got != "snap-tester" {
+		t.Errorf("name = %q, want %q", got, "snap-tester")
+	}
+	args := rendered["args"].([]interface{})
+	for i, want := range []string{"--user=tester", "0", "[  x]"} {
+		if args[i] != want {
+			t.Errorf("args[%d] = %q, want %q", i, args[i], want)
+		}
+	}
+	// The pipeline itself keeps the output as captured.
+	if pipeline["who"] != "tester\n" {
+		t.Errorf("pipeline was changed: %q", pipeline["who"])
+	}
+}
+
+func TestRenderParamsLiteralBraces(t *testing.T) {
+	params := map[string]interface{}{
+		"command": "docker",
+		"args":    []interface{}{"inspect", "--format", `{{ "{{" }}.State.Status}}`, "web"},
+	}
+	rendered, err := RenderParams(params, testVM, map[string]string{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rendered["args"].([]interface{})[2]; got != "{{.State.Status}}" {
+		t.Errorf("format = %q, want %q", got, "{{.State.Status}}")
+	}
+
+	// An unescaped "{{" is a template action, and the error says how to escape it.
+	params["args"] = []interface{}{"--format", "{{.State.Status"}
+	if _, err := RenderParams(params, testVM, map[string]string{}, true); err == nil || !strings.Contains(err.Error(), `{{ "{{" }}`) {
+		t.Errorf("error = %v, want one explaining the escape", err)
+	}
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmOperations"
+	"vnecro/vmTypes"
+)
+
+// defaultWaitForStateTimeout bounds a WaitForState operation that has no timeout of its own.
+const defaultWaitForStateTimeout = 5 * time.Minute
+
+// WaitForState polls the state of the VM specified in vmConfig until it is one of the states
+// given by the "state" parameter (a string or a list of strings). The "interval" parameter sets
+// the polling interval (default 1s). Without an operation timeout, it gives up after 5 minutes.
+// If op.StoreAs is set, the reached state is stored in the pipeline, along with the VM's
+// OS type, memory, CPU and network adapter counts under the ".os_type", ".memory_mb",
+// ".cpus" and ".nics" suffixes.
+func WaitForState(ctx context.Context, vmConfig *config.VMConfig, op config.Operation, pipeline map[string]string, operator vmOperations.VMOperator) error {
+	names, err := stringListParam(op, "state")
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("missing 'state' parameter for WaitForState operation")
+	}
+	var wanted []vmTypes.VMState
+	for _, name := range names {
+		state := vmTypes.VMState(strings.ToLower(name))
+		if !slices.Contains(vmTypes.KnownStates, state) {
+			return fmt.Errorf("invalid 'state' parameter for WaitForState operation: unknown state '%s'", name)
+		}
+		wanted = append(wanted, state)
+	}
+
+	interval := time.Second
+	if raw, ok := op.Params["interval"]; ok {
+		if interval, err = config.ParseTimeout(fmt.Sprint(raw)); err != nil || interval <= 0 {
+			return fmt.Errorf("invalid 'interval' parameter for WaitForState operation: '%v'", raw)
+		}
+	}
+	// The operation timeout, if any, is already applied to ctx.
+	limit := ""
+	if op.Timeout == "" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultWaitForStateTimeout)
+		defer cancel()
+		limit = fmt.Sprintf(" within %s", defaultWaitForStateTimeout)
+	}
+
+	logrus.Infof("Waiting for VM '%s' to be %s", vmConfig.VMName, strings.Join(names, " or "))
+	for {
+		info, err := operator.State(ctx, vmConfig.VMName)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("VM '%s' did not become %s%s: %w", vmConfig.VMName, strings.Join(names, " or "), limit, ctx.Err())
+			}
+			return fmt.Errorf("error querying state of VM '%s': %w", vmConfig.VMName, err)
+		}
+		if slices.Contains(wanted, info.State) {
+			logrus.Infof("VM '%s' is %s", vmConfig.VMName, info.State)
+			if op.StoreAs != "" {
+				pipeline[op.StoreAs] = string(info.State)
+				pipeline[op.StoreAs+".os_type"] = info.OSType
+				pipeline[op.StoreAs+".memory_mb"] = strconv.Itoa(info.MemoryMB)
+				pipeline[op.StoreAs+".cpus"] = strconv.Itoa(info.CPUs)
+				pipeline[op.StoreAs+".nics"] = strconv.Itoa(len(info.NICs))
+				logrus.Infof("Stored state in variable '%s'", op.StoreAs)
+			}
+			return nil
+		}
+		logrus.Debugf("VM '%s' is %s; waiting for %s", vmConfig.VMName, info.State, strings.Join(names, " or "))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("VM '%s' did not become %s%s (last state: %s): %w", vmConfig.VMName, strings.Join(names, " or "), limit, info.State, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
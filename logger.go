@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	"vnecro/redact"
 )
 
 // CustomFormatter formats log entries in the desired style.
@@ -40,8 +41,8 @@ func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 		level = levelColor + level + reset
 	}
 
-	// Compose the final log line.
-	logLine := fmt.Sprintf("[%s] [%s] %s\n", timestamp, level, entry.Message)
+	// Compose the final log line, masking any secrets in the message.
+	logLine := fmt.Sprintf("[%s] [%s] %s\n", timestamp, level, redact.String(entry.Message))
 	return []byte(logLine), nil
 }
 
@@ -1,27 +1,124 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"os"
 
 	"github.com/sirupsen/logrus"
 
 	"vnecro/config"
+	"vnecro/redact"
 )
 
 func main() {
+	// "vbnecro validate --config-path=..." only checks the configuration.
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validateCommand(os.Args[2:]))
+	}
+
 	// Define command-line flag for configuration file path.
-	configPath := flag.String("config-path", "", "Path to the YAML configuration file")
-	flag.Parse()
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configPath := flags.String("config-path", "", "Path to the YAML configuration file")
+	artifactsDir := flags.String("artifacts-dir", "", "Directory for files copied out of guests (overrides artifacts_dir)")
+	parallel := flags.Int("parallel", 0, "Maximum number of jobs on different VMs to run concurrently (overrides max_parallel)")
+	reportJUnit := flags.String("report-junit", "", "Write a JUnit XML report of the run to this file")
+	reportJSON := flags.String("report-json", "", "Write a JSON report of the run to this file")
+	if code, ok := parseFlags(flags, os.Args[1:]); !ok {
+		os.Exit(code)
+	}
 	if *configPath == "" {
-		logrus.Fatal("Missing required flag: --config-path")
+		logrus.Error("Missing required flag: --config-path")
+		os.Exit(exitConfigError)
 	}
 
-	// Load configuration from YAML.
+	// Load and validate configuration from YAML.
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
-		logrus.Fatalf("Failed to load config from '%s': %v", *configPath, err)
+		logrus.Errorf("Failed to load config from '%s': %v", *configPath, err)
+		os.Exit(exitConfigError)
+	}
+	redactPasswords(cfg)
+
+	// The command-line flag takes precedence over the config file.
+	if *parallel > 0 {
+		cfg.MaxParallel = *parallel
+	}
+	if *artifactsDir != "" {
+		cfg.ArtifactsDir = *artifactsDir
 	}
 
 	// Process jobs defined in the config.
-	ProcessJobs(cfg)
+	results, err := ProcessJobs(cfg)
+	if err != nil {
+		logrus.Errorf("Failed to run jobs from '%s': %v", *configPath, err)
+		os.Exit(exitConfigError)
+	}
+	printSummary(results)
+
+	// Write the requested reports; a report that cannot be written does not
+	// change the outcome of the run.
+	if *reportJUnit != "" {
+		if err := writeJUnitReport(*reportJUnit, results); err != nil {
+			logrus.Errorf("Failed to write JUnit report to '%s': %v", *reportJUnit, err)
+		} else {
+			logrus.Infof("JUnit report written to '%s'", *reportJUnit)
+		}
+	}
+	if *reportJSON != "" {
+		if err := writeJSONReport(*reportJSON, results); err != nil {
+			logrus.Errorf("Failed to write JSON report to '%s': %v", *reportJSON, err)
+		} else {
+			logrus.Infof("JSON report written to '%s'", *reportJSON)
+		}
+	}
+	os.Exit(exitCode(results))
+}
+
+// validateCommand implements the "validate" subcommand, which loads and validates
+// the configuration without touching any VM. Returns the process exit code.
+func validateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configPath := flags.String("config-path", "", "Path to the YAML configuration file")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if *configPath == "" {
+		logrus.Error("Missing required flag: --config-path")
+		return exitConfigError
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		logrus.Errorf("Configuration '%s' is invalid: %v", *configPath, err)
+		return exitConfigError
+	}
+	logrus.Infof("Configuration '%s' is valid (%d VM(s), %d job(s))", *configPath, len(cfg.VMs), len(cfg.Jobs))
+	return exitAllPassed
+}
+
+// redactPasswords registers every inline guest password with the redaction layer,
+// so that they never appear in logs or reports. Passwords from other sources are
+// registered when they are resolved.
+func redactPasswords(cfg *config.Config) {
+	for _, vm := range cfg.VMs {
+		for _, user := range vm.Users {
+			redact.Add(user.Password)
+		}
+	}
+}
+
+// parseFlags parses the command-line arguments. If they cannot be parsed, it returns
+// false and the exit code: exitConfigError for a bad flag, so that it is not mistaken
+// for the flag package's usual code 2 (exitRollbackFailed), or exitAllPassed for -help.
+// The flag package has already printed the error and usage.
+func parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	err := flags.Parse(args)
+	switch {
+	case err == nil:
+		return 0, true
+	case errors.Is(err, flag.ErrHelp):
+		return exitAllPassed, false
+	}
+	return exitConfigError, false
 }
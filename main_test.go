@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestParseFlagsExitCodes(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantCode int
+		wantOK   bool
+	}{
+		{args: []string{"--config-path", "config.yaml"}, wantOK: true},
+		{args: []string{"--bogus"}, wantCode: exitConfigError},
+		{args: []string{"--config-path"}, wantCode: exitConfigError},
+		{args: []string{"-h"}, wantCode: exitAllPassed},
+	}
+	for _, tt := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.String("config-path", "", "")
+		code, ok := parseFlags(flags, tt.args)
+		if ok != tt.wantOK || (!ok && code != tt.wantCode) {
+			t.Errorf("parseFlags(%q) = %d, %v, want %d, %v", tt.args, code, ok, tt.wantCode, tt.wantOK)
+		}
+	}
+}
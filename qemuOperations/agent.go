@@ -0,0 +1,270 @@
+package qemuOperations
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/vmTypes"
+)
+
+// fileChunkSize is the number of bytes moved per guest-file-read/guest-file-write call.
+// It keeps each base64-encoded agent message well below the agent's message size limit.
+const fileChunkSize = 48 * 1024
+
+// agentCommand sends a QMP command to the qemu-guest-agent of the given domain
+// through "virsh qemu-agent-command" and decodes the "return" member of the reply into result.
+func agentCommand(ctx context.Context, uri, vmName, execute string, arguments interface{}, result interface{}) error {
+	request := map[string]interface{}{"execute": execute}
+	if arguments != nil {
+		request["arguments"] = arguments
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	out, err := virsh(ctx, uri, "qemu-agent-command", vmName, string(payload))
+	if err != nil {
+		return fmt.Errorf("guest agent command '%s' failed: %w", execute, err)
+	}
+	if result == nil {
+		return nil
+	}
+	var reply struct {
+		Return json.RawMessage `json:"return"`
+	}
+	if err := json.Unmarshal([]byte(out), &reply); err != nil {
+		return fmt.Errorf("invalid reply to guest agent command '%s': %w", execute, err)
+	}
+	return json.Unmarshal(reply.Return, result)
+}
+
+// WaitForGuestExecReady polls the qemu-guest-agent with guest-ping until it answers,
+// the timeout is reached or the context is cancelled, printing a logrus message each second.
+// The agent runs commands with its own privileges, so the credentials are not used.
+func WaitForGuestExecReady(ctx context.Context, uri, vmName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	currentSecond := 0
+	for {
+		err := agentCommand(ctx, uri, vmName, "guest-ping", nil, nil)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped waiting for guest agent: %w", ctx.Err())
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for guest agent to be ready: last error: %v", err)
+		}
+		logrus.Printf("Waiting for guest agent to be ready on VM '%s' (%d / %d seconds)", vmName, currentSecond, int(timeout.Seconds()))
+		currentSecond++
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for guest agent: %w", ctx.Err())
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// guestExecStatus mirrors the reply of the guest-exec-status agent command.
+type guestExecStatus struct {
+	Exited   bool   `json:"exited"`
+	ExitCode int    `json:"exitcode"`
+	Signal   int    `json:"signal"`
+	OutData  string `json:"out-data"`
+	ErrData  string `json:"err-data"`
+}
+
+// ExecuteShellCommand executes a command inside the guest OS through the guest-exec agent
+// command, polling guest-exec-status until it exits, and returns its stdout, stderr,
+// exit code and duration. A non-zero exit is reported in the result rather than as an error.
+// The agent only returns the output once the command has exited, so cmd.OnOutput receives
+// all lines at the end.
+func ExecuteShellCommand(ctx context.Context, uri, vmName string, cmd vmTypes.GuestCommand) (*vmTypes.CommandResult, error) {
+	command, args := cmd.Argv()
+	if cmd.Cwd != "" {
+		// guest-exec has no working directory, so change it from a shell.
+		args = append([]string{"-c", `cd "$0" && exec "$@"`, cmd.Cwd, command}, args...)
+		command = "/bin/sh"
+	}
+	if len(cmd.Env) > 0 {
+		// guest-exec's env replaces the whole environment; env(1) adds to it.
+		args = append(append(slices.Clone(cmd.Env), command), args...)
+		command = "/usr/bin/env"
+	}
+	if args == nil {
+		args = []string{}
+	}
+	request := map[string]interface{}{
+		"path":           command,
+		"arg":            args,
+		"capture-output": true,
+	}
+
+	start := time.Now()
+	var started struct {
+		PID int `json:"pid"`
+	}
+	err := agentCommand(ctx, uri, vmName, "guest-exec", request, &started)
+	if err != nil {
+		return nil, fmt.Errorf("error executing shell command: %w", err)
+	}
+
+	for {
+		var status guestExecStatus
+		if err := agentCommand(ctx, uri, vmName, "guest-exec-status", map[string]int{"pid": started.PID}, &status); err != nil {
+			return nil, fmt.Errorf("error executing shell command: %w", err)
+		}
+		if status.Exited {
+			stdoutData, err := base64.StdEncoding.DecodeString(status.OutData)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding command output: %w", err)
+			}
+			stderrData, err := base64.StdEncoding.DecodeString(status.ErrData)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding command output: %w", err)
+			}
+			stdout, stderr := cmd.NewCapture("stdout"), cmd.NewCapture("stderr")
+			stdout.Write(stdoutData)
+			stderr.Write(stderrData)
+			result := vmTypes.NewCommandResult(stdout, stderr, time.Since(start))
+			result.ExitCode = status.ExitCode
+			if status.Signal != 0 {
+				// Mirror the shell convention for processes killed by a signal.
+				result.ExitCode = 128 + status.Signal
+			}
+			return result, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error executing shell command: %w", ctx.Err())
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// CopyToGuest copies host files into a directory inside the guest OS using the
+// guest-file-* agent commands. Directories are not supported by this backend,
+// so recursive only matters for the VirtualBox backend.
+func CopyToGuest(ctx context.Context, uri, vmName string, sources []string, targetDir string, recursive bool) error {
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err != nil {
+			return fmt.Errorf("error reading '%s': %w", source, err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("cannot copy directory '%s': the qemu backend only copies regular files", source)
+		}
+		target := path.Join(targetDir, filepath.Base(source))
+		if err := writeGuestFile(ctx, uri, vmName, source, target); err != nil {
+			return fmt.Errorf("error copying '%s' to '%s': %w", source, target, err)
+		}
+	}
+	return nil
+}
+
+// CopyFromGuest copies guest files into a host directory using the guest-file-*
+// agent commands. Directories are not supported by this backend.
+func CopyFromGuest(ctx context.Context, uri, vmName string, sources []string, targetDir string, recursive bool) error {
+	for _, source := range sources {
+		target := filepath.Join(targetDir, path.Base(source))
+		if err := readGuestFile(ctx, uri, vmName, source, target); err != nil {
+			return fmt.Errorf("error copying '%s' to '%s': %w", source, target, err)
+		}
+	}
+	return nil
+}
+
+// openGuestFile opens a guest file through the agent and returns its handle.
+func openGuestFile(ctx context.Context, uri, vmName, guestPath, mode string) (int, error) {
+	var handle int
+	err := agentCommand(ctx, uri, vmName, "guest-file-open", map[string]string{"path": guestPath, "mode": mode}, &handle)
+	return handle, err
+}
+
+// closeGuestFile closes a guest file handle, logging rather than returning failures.
+func closeGuestFile(ctx context.Context, uri, vmName string, handle int) {
+	if err := agentCommand(context.WithoutCancel(ctx), uri, vmName, "guest-file-close", map[string]int{"handle": handle}, nil); err != nil {
+		logrus.Warnf("Failed to close guest file handle %d on VM '%s': %v", handle, vmName, err)
+	}
+}
+
+// writeGuestFile streams a host file into the guest in base64-encoded chunks.
+func writeGuestFile(ctx context.Context, uri, vmName, hostPath, guestPath string) error {
+	file, err := os.Open(hostPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	handle, err := openGuestFile(ctx, uri, vmName, guestPath, "wb")
+	if err != nil {
+		return err
+	}
+	defer closeGuestFile(ctx, uri, vmName, handle)
+
+	buffer := make([]byte, fileChunkSize)
+	for {
+		n, err := file.Read(buffer)
+		if n > 0 {
+			arguments := map[string]interface{}{
+				"handle":  handle,
+				"buf-b64": base64.StdEncoding.EncodeToString(buffer[:n]),
+			}
+			if err := agentCommand(ctx, uri, vmName, "guest-file-write", arguments, nil); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readGuestFile streams a guest file to the host in base64-encoded chunks.
+func readGuestFile(ctx context.Context, uri, vmName, guestPath, hostPath string) error {
+	handle, err := openGuestFile(ctx, uri, vmName, guestPath, "rb")
+	if err != nil {
+		return err
+	}
+	defer closeGuestFile(ctx, uri, vmName, handle)
+
+	file, err := os.Create(hostPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		var chunk struct {
+			Count  int    `json:"count"`
+			BufB64 string `json:"buf-b64"`
+			EOF    bool   `json:"eof"`
+		}
+		arguments := map[string]int{"handle": handle, "count": fileChunkSize}
+		if err := agentCommand(ctx, uri, vmName, "guest-file-read", arguments, &chunk); err != nil {
+			return err
+		}
+		data, err := base64.StdEncoding.DecodeString(chunk.BufB64)
+		if err != nil {
+			return fmt.Errorf("error decoding file data: %w", err)
+		}
+		if _, err := file.Write(data); err != nil {
+			return err
+		}
+		if chunk.EOF || chunk.Count == 0 {
+			return file.Close()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package qemuOperations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// StartVM starts a libvirt domain.
+func StartVM(ctx context.Context, uri, vmName string) error {
+	if _, err := virsh(ctx, uri, "start", vmName); err != nil {
+		return fmt.Errorf("error starting VM '%s': %w", vmName, err)
+	}
+	return nil
+}
+
+// PauseVM suspends a running libvirt domain.
+func PauseVM(ctx context.Context, uri, vmName string) error {
+	if _, err := virsh(ctx, uri, "suspend", vmName); err != nil {
+		return fmt.Errorf("error pausing VM '%s': %w", vmName, err)
+	}
+	return nil
+}
+
+// ResumeVM resumes a suspended libvirt domain.
+func ResumeVM(ctx context.Context, uri, vmName string) error {
+	if _, err := virsh(ctx, uri, "resume", vmName); err != nil {
+		return fmt.Errorf("error resuming VM '%s': %w", vmName, err)
+	}
+	return nil
+}
+
+// ACPIShutdownVM asks the guest of a libvirt domain to shut down through ACPI.
+func ACPIShutdownVM(ctx context.Context, uri, vmName string) error {
+	if _, err := virsh(ctx, uri, "shutdown", vmName, "--mode", "acpi"); err != nil {
+		return fmt.Errorf("error sending ACPI shutdown to VM '%s': %w", vmName, err)
+	}
+	return nil
+}
+
+// SaveStateVM saves the state of a libvirt domain with a managed save, which
+// "virsh start" restores.
+func SaveStateVM(ctx context.Context, uri, vmName string) error {
+	if _, err := virsh(ctx, uri, "managedsave", vmName); err != nil {
+		return fmt.Errorf("error saving state of VM '%s': %w", vmName, err)
+	}
+	return nil
+}
+
+// ResetVM resets a running libvirt domain, like pressing its reset button.
+func ResetVM(ctx context.Context, uri, vmName string) error {
+	if _, err := virsh(ctx, uri, "reset", vmName); err != nil {
+		return fmt.Errorf("error resetting VM '%s': %w", vmName, err)
+	}
+	return nil
+}
+
+// ShutdownVM powers off a libvirt domain immediately, like pulling the plug.
+// If the domain is not running, it treats that as success.
+func ShutdownVM(ctx context.Context, uri, vmName string) error {
+	info, err := DomainInfo(ctx, uri, vmName)
+	if err != nil {
+		return fmt.Errorf("error shutting down VM '%s': %w", vmName, err)
+	}
+	if info.State.IsOff() {
+		return nil
+	}
+	if _, err := virsh(ctx, uri, "destroy", vmName); err != nil {
+		// The domain may have stopped on its own since its state was queried.
+		if strings.Contains(strings.ToLower(err.Error()), "not running") {
+			return nil
+		}
+		return fmt.Errorf("error shutting down VM '%s': %w", vmName, err)
+	}
+	return nil
+}
+
+// Rollback restores the given domain to the specified snapshot in case of contingencies.
+// It first powers off the domain, then reverts to the snapshot.
+func Rollback(ctx context.Context, uri, vmName, snapshot string) error {
+	if err := ShutdownVM(ctx, uri, vmName); err != nil {
+		return fmt.Errorf("failed to shutdown VM '%s': %v", vmName, err)
+	}
+	if err := RestoreSnapshot(ctx, uri, vmName, snapshot); err != nil {
+		return fmt.Errorf("failed to restore snapshot '%s' on VM '%s': %v", snapshot, vmName, err)
+	}
+	return nil
+}
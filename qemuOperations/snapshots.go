@@ -0,0 +1,102 @@
+package qemuOperations
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"vnecro/vmTypes"
+)
+
+// domainSnapshotXML mirrors the parts of "virsh snapshot-dumpxml" output that are needed.
+type domainSnapshotXML struct {
+	Name         string `xml:"name"`
+	Description  string `xml:"description"`
+	CreationTime int64  `xml:"creationTime"`
+	Parent       struct {
+		Name string `xml:"name"`
+	} `xml:"parent"`
+}
+
+// ListSnapshots lists the snapshots of a libvirt domain as a tree.
+// libvirt identifies snapshots by name only, so each snapshot's UUID is its name.
+func ListSnapshots(ctx context.Context, uri, vmName string) (*vmTypes.SnapshotTree, error) {
+	out, err := virsh(ctx, uri, "snapshot-list", vmName, "--name", "--topological")
+	if err != nil {
+		return nil, fmt.Errorf("error listing snapshots: %w", err)
+	}
+
+	current := ""
+	if out, err := virsh(ctx, uri, "snapshot-current", vmName, "--name"); err == nil {
+		current = strings.TrimSpace(out)
+	}
+
+	tree := &vmTypes.SnapshotTree{}
+	nodes := make(map[string]*vmTypes.Snapshot)
+	for _, name := range strings.Split(out, "\n") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		dump, err := virsh(ctx, uri, "snapshot-dumpxml", vmName, "--snapshotname", name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading snapshot '%s': %w", name, err)
+		}
+		var info domainSnapshotXML
+		if err := xml.Unmarshal([]byte(dump), &info); err != nil {
+			return nil, fmt.Errorf("error parsing snapshot '%s': %w", name, err)
+		}
+
+		snapshot := &vmTypes.Snapshot{
+			Name:        name,
+			UUID:        name,
+			Description: info.Description,
+			Current:     name == current,
+		}
+		if info.CreationTime > 0 {
+			snapshot.TimeStamp = time.Unix(info.CreationTime, 0)
+		}
+		nodes[name] = snapshot
+
+		// --topological lists parents before their children.
+		if parent, ok := nodes[info.Parent.Name]; ok {
+			snapshot.Parent = parent
+			parent.Children = append(parent.Children, snapshot)
+		} else {
+			tree.Roots = append(tree.Roots, snapshot)
+		}
+	}
+	return tree, nil
+}
+
+// RestoreSnapshot reverts the given domain to the named snapshot.
+func RestoreSnapshot(ctx context.Context, uri, vmName, snapshot string) error {
+	if _, err := virsh(ctx, uri, "snapshot-revert", vmName, "--snapshotname", snapshot); err != nil {
+		return fmt.Errorf("error restoring snapshot '%s': %w", snapshot, err)
+	}
+	return nil
+}
+
+// TakeSnapshot takes an internal snapshot of the given domain with an optional description.
+// libvirt internal snapshots of a running domain always include its memory and
+// briefly pause it, so the live flag has no effect on this backend.
+func TakeSnapshot(ctx context.Context, uri, vmName, name, description string) error {
+	args := []string{"snapshot-create-as", vmName, "--name", name}
+	if description != "" {
+		args = append(args, "--description", description)
+	}
+	if _, err := virsh(ctx, uri, args...); err != nil {
+		return fmt.Errorf("error taking snapshot '%s': %w", name, err)
+	}
+	return nil
+}
+
+// DeleteSnapshot deletes the named snapshot of the given domain.
+func DeleteSnapshot(ctx context.Context, uri, vmName, snapshot string) error {
+	if _, err := virsh(ctx, uri, "snapshot-delete", vmName, "--snapshotname", snapshot); err != nil {
+		return fmt.Errorf("error deleting snapshot '%s': %w", snapshot, err)
+	}
+	return nil
+}
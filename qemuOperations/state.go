@@ -0,0 +1,97 @@
+package qemuOperations
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vnecro/vmTypes"
+)
+
+// domainStates maps the states printed by "virsh domstate" to VM states.
+var domainStates = map[string]vmTypes.VMState{
+	"running":     vmTypes.StateRunning,
+	"idle":        vmTypes.StateRunning,
+	"blocked":     vmTypes.StateRunning,
+	"paused":      vmTypes.StatePaused,
+	"pmsuspended": vmTypes.StatePaused,
+	"in shutdown": vmTypes.StateStopping,
+	"shut off":    vmTypes.StatePowerOff,
+	"crashed":     vmTypes.StateAborted,
+}
+
+// DomainInfo queries the state and hardware of a libvirt domain with
+// "virsh domstate", "virsh dominfo" and "virsh domiflist".
+func DomainInfo(ctx context.Context, uri, vmName string) (*vmTypes.VMInfo, error) {
+	out, err := virsh(ctx, uri, "domstate", vmName, "--reason")
+	if err != nil {
+		return nil, fmt.Errorf("error reading state of VM '%s': %w", vmName, err)
+	}
+	info := &vmTypes.VMInfo{State: parseDomainState(out)}
+
+	out, err = virsh(ctx, uri, "dominfo", vmName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading info of VM '%s': %w", vmName, err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "OS Type":
+			info.OSType = value
+		case "CPU(s)":
+			info.CPUs, _ = strconv.Atoi(value)
+		case "Max memory":
+			kib, _ := strconv.Atoi(strings.TrimSuffix(value, " KiB"))
+			info.MemoryMB = kib / 1024
+		}
+	}
+
+	out, err = virsh(ctx, uri, "domiflist", vmName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading network interfaces of VM '%s': %w", vmName, err)
+	}
+	info.NICs = parseInterfaceList(out)
+	return info, nil
+}
+
+// parseDomainState converts the output of "virsh domstate --reason", e.g. "shut off (saved)", into a VM state.
+func parseDomainState(output string) vmTypes.VMState {
+	state, reason, _ := strings.Cut(strings.TrimSpace(output), " (")
+	if state == "shut off" && strings.HasPrefix(reason, "saved") {
+		// A managed save restores the domain on its next start.
+		return vmTypes.StateSaved
+	}
+	if mapped, ok := domainStates[state]; ok {
+		return mapped
+	}
+	return vmTypes.StateUnknown
+}
+
+// parseInterfaceList parses the table printed by "virsh domiflist":
+// a header, a dashed separator, then one "Interface Type Source Model MAC" row per adapter.
+func parseInterfaceList(output string) []vmTypes.NIC {
+	var nics []vmTypes.NIC
+	rows := false
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "---") {
+			rows = true
+			continue
+		}
+		fields := strings.Fields(line)
+		if !rows || len(fields) < 5 {
+			continue
+		}
+		nics = append(nics, vmTypes.NIC{
+			Index:      len(nics) + 1,
+			Attachment: fields[1],
+			Network:    fields[2],
+			MACAddress: fields[4],
+		})
+	}
+	return nics
+}
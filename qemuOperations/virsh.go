@@ -0,0 +1,28 @@
+package qemuOperations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// virsh runs a virsh command against the given libvirt connection URI
+// (the libvirt default if empty) and returns its standard output.
+func virsh(ctx context.Context, uri string, args ...string) (string, error) {
+	if uri != "" {
+		args = append([]string{"--connect", uri}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "virsh", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,111 @@
+// Package redact masks secrets, such as guest passwords and the output of
+// operations marked sensitive, in log lines and reports.
+package redact
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces every secret in redacted text.
+const Mask = "****"
+
+var (
+	mu        sync.RWMutex
+	secrets   = map[string]bool{}
+	replacer  = strings.NewReplacer()
+	listeners []*listener
+)
+
+// minLineLength is the shortest line of a multi-line secret that is masked on its own.
+// Shorter lines, such as "{" or "true", would mask unrelated text everywhere.
+const minLineLength = 6
+
+// Add registers a secret to be masked from now on. Surrounding whitespace is ignored,
+// and each line of a multi-line secret that is at least minLineLength long is registered
+// as well, so that it is masked when printed on its own. Empty secrets are ignored.
+func Add(secret string) {
+	values := []string{strings.TrimSpace(secret)}
+	if strings.Contains(values[0], "\n") {
+		for _, line := range strings.Split(values[0], "\n") {
+			if line = strings.TrimSpace(line); len(line) >= minLineLength {
+				values = append(values, line)
+			}
+		}
+	}
+
+	if !register(values) {
+		return
+	}
+	mu.RLock()
+	notify := listeners
+	mu.RUnlock()
+	for _, l := range notify {
+		l.f()
+	}
+}
+
+// listener is a function registered with OnAdd; its address identifies it for removal.
+type listener struct {
+	f func()
+}
+
+// OnAdd registers f to be called whenever a new secret has been added, e.g. to
+// rewrite a file that may already contain it. The returned function unregisters f.
+func OnAdd(f func()) func() {
+	l := &listener{f: f}
+	mu.Lock()
+	defer mu.Unlock()
+	listeners = append(listeners, l)
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		// Build a new slice, as Add may be iterating over the current one.
+		listeners = slices.DeleteFunc(slices.Clone(listeners), func(other *listener) bool { return other == l })
+	}
+}
+
+// register adds the values to the secrets and rebuilds the replacer.
+// Returns whether any of them was new.
+func register(values []string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	changed := false
+	for _, v := range values {
+		if v != "" && !secrets[v] {
+			secrets[v] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+
+	// Replace longer secrets first, so a secret containing another is masked whole.
+	sorted := make([]string, 0, len(secrets))
+	for s := range secrets {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, s := range sorted {
+		pairs = append(pairs, s, Mask)
+	}
+	replacer = strings.NewReplacer(pairs...)
+	return true
+}
+
+// String returns s with every registered secret replaced by Mask.
+func String(s string) string {
+	mu.RLock()
+	r := replacer
+	mu.RUnlock()
+	return r.Replace(s)
+}
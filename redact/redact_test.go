@@ -0,0 +1,23 @@
+package redact
+
+import "testing"
+
+func TestOnAddUnregister(t *testing.T) {
+	calls := 0
+	unregister := OnAdd(func() { calls++ })
+
+	Add("listener-secret-1")
+	Add("listener-secret-1")
+	if calls != 1 {
+		t.Fatalf("listener called %d times, want once for one new secret", calls)
+	}
+
+	unregister()
+	Add("listener-secret-2")
+	if calls != 1 {
+		t.Errorf("unregistered listener was called")
+	}
+	if got := String("listener-secret-2"); got != Mask {
+		t.Errorf("String = %q, want %q", got, Mask)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+
+	"vnecro/redact"
+)
+
+// junitTestSuites is the root element of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the test cases of one job.
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+// junitProperty is a name/value pair attached to a test suite.
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase is one operation of a job.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitProblem describes a failed (assertion) or errored (any other) test case.
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSkipped marks a test case that did not run.
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// addCase appends a test case to the suite and updates its counters.
+func (s *junitTestSuite) addCase(c junitTestCase) {
+	s.Tests++
+	switch {
+	case c.Failure != nil:
+		s.Failures++
+	case c.Error != nil:
+		s.Errors++
+	case c.Skipped != nil:
+		s.Skipped++
+	}
+	s.Cases = append(s.Cases, c)
+}
+
+// writeJUnitReport writes the results as JUnit XML: one test suite per job and one
+// test case per operation. Failed assertions are reported as <failure> elements,
+// other failed operations as <error> elements, and stored command output as system-out.
+func writeJUnitReport(path string, results []*JobResult) error {
+	report := junitTestSuites{Name: "vbnecro"}
+	var total time.Duration
+	for _, r := range results {
+		suite := junitTestSuite{
+			Name:       r.Name,
+			Time:       seconds(r.Duration),
+			Properties: []junitProperty{{Name: "vm_alias", Value: r.VMAlias}, {Name: "status", Value: r.Status.String()}},
+		}
+		if !r.Started.IsZero() {
+			suite.Timestamp = r.Started.Format("2006-01-02T15:04:05")
+		}
+
+		// A job can fail before its first operation, e.g. while ensuring the VM is off.
+		if r.Status == jobFailed && r.FailedOperation == 0 {
+			name := r.FailedOperationType
+			if name == "" {
+				name = "setup"
+			}
+			suite.addCase(junitTestCase{Name: name, ClassName: r.Name, Time: seconds(0),
+				Error: &junitProblem{Message: firstLine(errorString(r.Err)), Type: name, Text: errorString(r.Err)}})
+		}
+
+		// Keep skipped jobs without operations visible in the report.
+		if r.Status == jobSkipped && len(r.Operations) == 0 {
+			suite.addCase(junitTestCase{Name: "job", ClassName: r.Name, Time: seconds(0),
+				Skipped: &junitSkipped{Message: errorString(r.Err)}})
+		}
+
+		for _, op := range r.Operations {
+			c := junitTestCase{
+				Name:      operationName(op),
+				ClassName: r.Name,
+				Time:      seconds(op.Duration),
+				SystemOut: redact.String(op.Output),
+			}
+			switch op.Status {
+			case jobFailed:
+				message := firstLine(errorString(op.Err))
+				if op.Attempts > 1 {
+					message = fmt.Sprintf("%s (after %d attempts)", message, op.Attempts)
+				}
+				problem := &junitProblem{Message: message, Type: op.Type, Text: errorString(op.Err)}
+				if op.Type == "Assert" {
+					c.Failure = problem
+				} else {
+					c.Error = problem
+				}
+			case jobSkipped:
+				reason := "not run"
+				if op.SkipReason != "" {
+					reason = op.SkipReason
+				} else if r.Status == jobSkipped && r.Err != nil {
+					reason = errorString(r.Err)
+				} else if r.FailedOperation > 0 {
+					reason = "an earlier operation failed"
+				}
+				c.Skipped = &junitSkipped{Message: redact.String(reason)}
+			}
+			suite.addCase(c)
+		}
+
+		if r.Rollback != rollbackNone {
+			c := junitTestCase{Name: "rollback_on_failure", ClassName: r.Name, Time: seconds(0)}
+			if r.Rollback == rollbackFailed {
+				c.Error = &junitProblem{Message: firstLine(errorString(r.RollbackErr)), Type: "Rollback", Text: errorString(r.RollbackErr)}
+			}
+			suite.addCase(c)
+		}
+
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+		total += r.Duration
+		report.Suites = append(report.Suites, suite)
+	}
+	report.Time = seconds(total)
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o644)
+}
+
+// jsonOperation is one operation in the JSON report.
+type jsonOperation struct {
+	Index           int     `json:"index"`
+	Type            string  `json:"type"`
+	Status          string  `json:"status"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Phase           string  `json:"phase,omitempty"`
+	Attempts        int     `json:"attempts"`
+	SkipReason      string  `json:"skip_reason,omitempty"`
+	Output          string  `json:"output,omitempty"`
+}
+
+// jsonJob is one job in the JSON report.
+type jsonJob struct {
+	Name                string          `json:"name"`
+	VMAlias             string          `json:"vm_alias"`
+	Status              string          `json:"status"`
+	Started             *time.Time      `json:"started,omitempty"`
+	DurationSeconds     float64         `json:"duration_seconds"`
+	FailedOperation     int             `json:"failed_operation,omitempty"`
+	FailedOperationType string          `json:"failed_operation_type,omitempty"`
+	Error               string          `json:"error,omitempty"`
+	Rollback            string          `json:"rollback,omitempty"`
+	RollbackError       string          `json:"rollback_error,omitempty"`
+	Operations          []jsonOperation `json:"operations"`
+}
+
+// jsonReport is the root object of the JSON report.
+type jsonReport struct {
+	ExitCode int       `json:"exit_code"`
+	Jobs     []jsonJob `json:"jobs"`
+}
+
+// writeJSONReport writes the results, including every operation, as a JSON document.
+func writeJSONReport(path string, results []*JobResult) error {
+	report := jsonReport{ExitCode: exitCode(results), Jobs: []jsonJob{}}
+	for _, r := range results {
+		job := jsonJob{
+			Name:                r.Name,
+			VMAlias:             r.VMAlias,
+			Status:              r.Status.String(),
+			DurationSeconds:     r.Duration.Seconds(),
+			FailedOperation:     r.FailedOperation,
+			FailedOperationType: r.FailedOperationType,
+			Error:               errorString(r.Err),
+			RollbackError:       errorString(r.RollbackErr),
+			Operations:          []jsonOperation{},
+		}
+		if !r.Started.IsZero() {
+			started := r.Started
+			job.Started = &started
+		}
+		if r.Rollback != rollbackNone {
+			job.Rollback = r.Rollback.String()
+		}
+		for _, op := range r.Operations {
+			job.Operations = append(job.Operations, jsonOperation{
+				Index:           op.Index,
+				Type:            op.Type,
+				Status:          op.Status.String(),
+				Error:           errorString(op.Err),
+				DurationSeconds: op.Duration.Seconds(),
+				Phase:           op.Phase,
+				Attempts:        op.Attempts,
+				SkipReason:      redact.String(op.SkipReason),
+				Output:          redact.String(op.Output),
+			})
+		}
+		report.Jobs = append(report.Jobs, job)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// operationName names an operation's test case: "03 StartVM" for the job's
+// operations, or "on_failure 01 CopyFromGuest" for cleanup operations.
+func operationName(op OperationResult) string {
+	name := fmt.Sprintf("%02d %s", op.Index, op.Type)
+	if op.Phase != "" {
+		name = op.Phase + " " + name
+	}
+	return name
+}
+
+// seconds formats a duration as fractional seconds, as JUnit expects.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// errorString returns the error's message with secrets masked, or "" for a nil error.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return redact.String(err.Error())
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+)
+
+// Process exit codes, so that CI can tell the outcome of a run.
+const (
+	exitAllPassed      = 0
+	exitJobsFailed     = 1
+	exitRollbackFailed = 2
+	exitConfigError    = 3
+)
+
+// jobStatus is the scheduling state of a job.
+type jobStatus int
+
+const (
+	jobPending jobStatus = iota
+	jobRunning
+	jobSucceeded
+	jobFailed
+	jobSkipped
+)
+
+// String returns the status as shown in the summary.
+func (s jobStatus) String() string {
+	switch s {
+	case jobPending:
+		return "pending"
+	case jobRunning:
+		return "running"
+	case jobSucceeded:
+		return "passed"
+	case jobFailed:
+		return "failed"
+	case jobSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// rollbackOutcome tells whether a failed job's VM was rolled back.
+type rollbackOutcome int
+
+const (
+	rollbackNone rollbackOutcome = iota
+	rollbackSucceeded
+	rollbackFailed
+)
+
+// String returns the rollback outcome as shown in the summary.
+func (r rollbackOutcome) String() string {
+	switch r {
+	case rollbackSucceeded:
+		return "succeeded"
+	case rollbackFailed:
+		return "failed"
+	}
+	return "-"
+}
+
+// OperationResult is the outcome of one operation of a job.
+type OperationResult struct {
+	// Phase is empty for the job's operations, or the cleanup list the
+	// operation belongs to: "on_failure", "on_success" or "always".
+	Phase string
+	// Index is the 1-based position of the operation in its job or cleanup list.
+	Index    int
+	Type     string
+	Status   jobStatus
+	Err      error
+	Duration time.Duration
+	// SkipReason explains why a skipped operation did not run, if it is not
+	// simply an earlier failure.
+	SkipReason string
+	// Attempts is how many times the operation ran, including retries; 0 if it did not run.
+	Attempts int
+	// Output is the command output stored via store_as, if any.
+	Output string
+}
+
+// JobResult is the outcome of one job of a run.
+type JobResult struct {
+	Name    string
+	VMAlias string
+	Status  jobStatus
+	// FailedOperation is the 1-based index of the operation that failed, or 0 if none did.
+	FailedOperation     int
+	FailedOperationType string
+	Err                 error
+	Started             time.Time
+	Duration            time.Duration
+	Rollback            rollbackOutcome
+	RollbackErr         error
+	Operations          []OperationResult
+}
+
+// newJobResult returns the result of a job that has not run yet; all of its
+// operations are marked as skipped until they run.
+func newJobResult(job *config.JobConfig, status jobStatus) *JobResult {
+	result := &JobResult{Name: job.Name, VMAlias: job.VMAlias, Status: status}
+	phases := []struct {
+		name string
+		ops  []config.Operation
+	}{{"", job.Operations}, {"on_failure", job.OnFailure}, {"on_success", job.OnSuccess}, {"always", job.Always}}
+	for _, phase := range phases {
+		for i, op := range phase.ops {
+			result.Operations = append(result.Operations, OperationResult{Phase: phase.name, Index: i + 1, Type: op.Type, Status: jobSkipped})
+		}
+	}
+	return result
+}
+
+// phaseOperations returns the results of the operations of one phase ("" for the
+// job's operations). They are stored contiguously, so the returned slice shares them.
+func (r *JobResult) phaseOperations(phase string) []OperationResult {
+	start := -1
+	for i, op := range r.Operations {
+		if op.Phase == phase && start == -1 {
+			start = i
+		}
+		if op.Phase != phase && start != -1 {
+			return r.Operations[start:i]
+		}
+	}
+	if start == -1 {
+		return nil
+	}
+	return r.Operations[start:]
+}
+
+// exitCode maps the results of a run to the process exit code: a failed rollback
+// takes precedence over failed or skipped jobs.
+func exitCode(results []*JobResult) int {
+	code := exitAllPassed
+	for _, r := range results {
+		if r.Rollback == rollbackFailed {
+			return exitRollbackFailed
+		}
+		if r.Status != jobSucceeded {
+			code = exitJobsFailed
+		}
+	}
+	return code
+}
+
+// printSummary logs a table with one row per job.
+func printSummary(results []*JobResult) {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tVM\tSTATUS\tDURATION\tFAILED OPERATION\tROLLBACK\tERROR")
+	passed := 0
+	for _, r := range results {
+		if r.Status == jobSucceeded {
+			passed++
+		}
+		failedOp := "-"
+		if r.FailedOperation > 0 {
+			failedOp = fmt.Sprintf("#%d %s", r.FailedOperation, r.FailedOperationType)
+			if attempts := r.Operations[r.FailedOperation-1].Attempts; attempts > 1 {
+				failedOp += fmt.Sprintf(" (%d attempts)", attempts)
+			}
+		} else if r.FailedOperationType != "" {
+			failedOp = r.FailedOperationType
+		}
+		errMsg := "-"
+		if r.Err != nil {
+			errMsg = firstLine(r.Err.Error())
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Name, r.VMAlias, r.Status,
+			r.Duration.Round(time.Millisecond), failedOp, r.Rollback, errMsg)
+	}
+	w.Flush()
+	logrus.Infof("Job summary: %d of %d job(s) passed\n%s", passed, len(results), strings.TrimSuffix(sb.String(), "\n"))
+}
+
+// firstLine returns the first line of s, marking that more lines were cut off.
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		return s[:i] + " ..."
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+)
+
+// defaultRetryDelay is the delay before the first retry if retry_delay is not set.
+const defaultRetryDelay = 5 * time.Second
+
+// retryPolicy describes how often and when a failed operation is retried.
+type retryPolicy struct {
+	retries  int
+	delay    time.Duration
+	backoff  string
+	patterns []*regexp.Regexp
+}
+
+// newRetryPolicy reads the retry settings of an operation.
+func newRetryPolicy(op config.Operation) (*retryPolicy, error) {
+	policy := &retryPolicy{retries: op.Retries, delay: defaultRetryDelay, backoff: op.RetryBackoff}
+	if op.RetryDelay != "" {
+		delay, err := config.ParseTimeout(op.RetryDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_delay: %w", err)
+		}
+		policy.delay = delay
+	}
+	for _, pattern := range op.RetryOn {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_on pattern '%s': %w", pattern, err)
+		}
+		policy.patterns = append(policy.patterns, re)
+	}
+	return policy, nil
+}
+
+// retryable reports whether an error may be retried: any error if no retry_on
+// patterns are given, otherwise only errors matching one of them.
+func (p *retryPolicy) retryable(err error) bool {
+	if len(p.patterns) == 0 {
+		return true
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// delayAfter returns how long to wait after the given failed attempt (1-based):
+// the same delay each time by default, growing linearly or doubling with a backoff.
+func (p *retryPolicy) delayAfter(attempt int) time.Duration {
+	switch p.backoff {
+	case "linear":
+		return p.delay * time.Duration(attempt)
+	case "exponential":
+		return p.delay * time.Duration(math.Pow(2, float64(attempt-1)))
+	}
+	return p.delay
+}
+
+// runWithRetries runs an operation, retrying it according to its retry policy.
+// Each attempt gets the operation's full timeout. Retries stop once the job is
+// cancelled or times out. Returns the number of attempts made and the last error.
+func runWithRetries(ctx context.Context, run *jobRun, op config.Operation) (int, error) {
+	policy, err := newRetryPolicy(op)
+	if err != nil {
+		return 1, err
+	}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			logrus.Infof("Retrying operation %s (attempt %d of %d)", op.Type, attempt, policy.retries+1)
+		}
+		err := runOperation(ctx, run, op)
+		if err == nil || attempt > policy.retries || ctx.Err() != nil {
+			return attempt, err
+		}
+		if !policy.retryable(err) {
+			logrus.Infof("Not retrying operation %s: error does not match retry_on", op.Type)
+			return attempt, err
+		}
+		delay := policy.delayAfter(attempt)
+		logrus.Warnf("Operation %s failed (attempt %d of %d): %v; retrying in %s",
+			op.Type, attempt, policy.retries+1, err, delay)
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package vboxOperations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CopyToGuest copies host files or directories into a directory inside the guest OS
+// using VBoxManage guestcontrol copyto. Directories are only copied if recursive is true.
+func CopyToGuest(ctx context.Context, runner Runner, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	return guestCopy(ctx, runner, "copyto", vmName, username, password, sources, targetDir, recursive)
+}
+
+// CopyFromGuest copies guest files or directories into a host directory
+// using VBoxManage guestcontrol copyfrom. Directories are only copied if recursive is true.
+func CopyFromGuest(ctx context.Context, runner Runner, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	return guestCopy(ctx, runner, "copyfrom", vmName, username, password, sources, targetDir, recursive)
+}
+
+// guestCopy is a helper that issues a guestcontrol copy subcommand and captures error output.
+func guestCopy(ctx context.Context, runner Runner, subcommand, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	cmdArgs := []string{"--target-directory", targetDir}
+	if recursive {
+		cmdArgs = append(cmdArgs, "--recursive")
+	}
+	cmdArgs = append(cmdArgs, "--")
+	cmdArgs = append(cmdArgs, sources...)
+
+	if _, stderr, err := runGuestControl(ctx, runner, vmName, subcommand, username, password, cmdArgs...); err != nil {
+		return fmt.Errorf("error running guestcontrol %s: %w: %s", subcommand, err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
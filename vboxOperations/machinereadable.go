@@ -0,0 +1,67 @@
+package vboxOperations
+
+import (
+	"strings"
+)
+
+// parseMachineReadable parses the key="value" lines printed by VBoxManage's
+// --machinereadable options into a map. Quoted values may contain escaped
+// characters (\", \\, \n) or, on older VirtualBox versions, span several lines.
+func parseMachineReadable(output string) map[string]string {
+	values := make(map[string]string)
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			continue
+		}
+		key := strings.Trim(line[:eq], `"`)
+		value := line[eq+1:]
+
+		if strings.HasPrefix(value, `"`) {
+			// Keep consuming lines until the closing quote is found.
+			for !hasClosingQuote(value) && i+1 < len(lines) {
+				i++
+				value += "\n" + lines[i]
+			}
+			value = unquoteMachineReadable(value)
+		}
+		values[key] = value
+	}
+	return values
+}
+
+// hasClosingQuote reports whether a quoted value ends with an unescaped quote.
+func hasClosingQuote(value string) bool {
+	if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+		return false
+	}
+	// Count the backslashes immediately preceding the final quote.
+	backslashes := 0
+	for i := len(value) - 2; i > 0 && value[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 0
+}
+
+// unquoteMachineReadable strips the surrounding quotes and resolves escapes.
+func unquoteMachineReadable(value string) string {
+	value = strings.TrimPrefix(value, `"`)
+	value = strings.TrimSuffix(value, `"`)
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte(value[i])
+			}
+			continue
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
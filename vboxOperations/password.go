@@ -0,0 +1,67 @@
+package vboxOperations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writePasswordFile writes a guest password to a temporary file that only the current
+// user can read, so it can be passed to VBoxManage with --passwordfile instead of
+// appearing on the command line. The returned function removes the file.
+func writePasswordFile(password string) (string, func(), error) {
+	// os.CreateTemp creates the file with mode 0600.
+	file, err := os.CreateTemp("", "vnecro-password-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating password file: %w", err)
+	}
+	remove := func() {
+		if err := os.Remove(file.Name()); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Failed to remove password file '%s': %v", file.Name(), err)
+		}
+	}
+	if err := file.Chmod(0o600); err != nil {
+		file.Close()
+		remove()
+		return "", nil, fmt.Errorf("error securing password file: %w", err)
+	}
+	if _, err := file.WriteString(password); err != nil {
+		file.Close()
+		remove()
+		return "", nil, fmt.Errorf("error writing password file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		remove()
+		return "", nil, fmt.Errorf("error writing password file: %w", err)
+	}
+	return file.Name(), remove, nil
+}
+
+// runGuestControl runs "VBoxManage guestcontrol <vm> <subcommand>" with the given
+// arguments, authenticating as username, and returns its output.
+func runGuestControl(ctx context.Context, runner Runner, vmName, subcommand, username, password string, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := streamGuestControl(ctx, runner, &stdout, &stderr, vmName, subcommand, username, password, args...)
+	return stdout.String(), stderr.String(), err
+}
+
+// streamGuestControl is runGuestControl writing the output to stdout and stderr while
+// VBoxManage runs. The password is passed through a temporary password file that is
+// removed as soon as VBoxManage exits.
+func streamGuestControl(ctx context.Context, runner Runner, stdout, stderr io.Writer, vmName, subcommand, username, password string, args ...string) error {
+	passwordFile, remove, err := writePasswordFile(password)
+	if err != nil {
+		return err
+	}
+	defer remove()
+	cmdArgs := []string{
+		"guestcontrol", vmName, subcommand,
+		"--username", username,
+		"--passwordfile", passwordFile,
+	}
+	return runner.RunStreaming(ctx, stdout, stderr, append(cmdArgs, args...)...)
+}
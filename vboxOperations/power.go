@@ -1,62 +1,79 @@
 package vboxOperations
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"os/exec"
 	"strings"
+
+	"vnecro/vmTypes"
 )
 
 // StartVM starts a VirtualBox VM in headless mode.
-func StartVM(vmName string) error {
-	cmd := exec.Command("VBoxManage", "startvm", vmName, "--type", "headless")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error starting VM '%s': %w", vmName, err)
+func StartVM(ctx context.Context, runner Runner, vmName string) error {
+	if _, stderr, err := runner.Run(ctx, "startvm", vmName, "--type", "headless"); err != nil {
+		return fmt.Errorf("error starting VM '%s': %w: %s", vmName, err, strings.TrimSpace(stderr))
 	}
 	return nil
 }
 
 // PauseVM pauses a running VirtualBox VM.
-func PauseVM(vmName string) error {
-	cmd := exec.Command("VBoxManage", "controlvm", vmName, "pause")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error pausing VM '%s': %w", vmName, err)
+func PauseVM(ctx context.Context, runner Runner, vmName string) error {
+	if _, stderr, err := runner.Run(ctx, "controlvm", vmName, "pause"); err != nil {
+		return fmt.Errorf("error pausing VM '%s': %w: %s", vmName, err, strings.TrimSpace(stderr))
 	}
 	return nil
 }
 
 // ResumeVM resumes a paused VirtualBox VM.
-func ResumeVM(vmName string) error {
-	cmd := exec.Command("VBoxManage", "controlvm", vmName, "resume")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error resuming VM '%s': %w", vmName, err)
+func ResumeVM(ctx context.Context, runner Runner, vmName string) error {
+	if _, stderr, err := runner.Run(ctx, "controlvm", vmName, "resume"); err != nil {
+		return fmt.Errorf("error resuming VM '%s': %w: %s", vmName, err, strings.TrimSpace(stderr))
 	}
 	return nil
 }
 
-// ShutdownVM attempts to shut down a VM.
-// If the VM is not running or is aborted, it treats that as success.
-func ShutdownVM(vmName string) error {
-	err := shutdown(vmName)
-	if err != nil {
-		errMsg := strings.ToLower(err.Error())
+// ResetVM resets a running VirtualBox VM, like pressing its reset button.
+func ResetVM(ctx context.Context, runner Runner, vmName string) error {
+	if _, stderr, err := runner.Run(ctx, "controlvm", vmName, "reset"); err != nil {
+		return fmt.Errorf("error resetting VM '%s': %w: %s", vmName, err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
 
-		// Treat "not currently running" or "aborted" as success.
-		if strings.Contains(errMsg, "not currently running") || strings.Contains(errMsg, "aborted") {
-			return nil
-		}
+// ACPIShutdownVM presses the ACPI power button of a running VirtualBox VM.
+func ACPIShutdownVM(ctx context.Context, runner Runner, vmName string) error {
+	if _, stderr, err := runner.Run(ctx, "controlvm", vmName, "acpipowerbutton"); err != nil {
+		return fmt.Errorf("error sending ACPI shutdown to VM '%s': %w: %s", vmName, err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
 
-		// If the error indicates that the VM is paused, try to resume and retry shutdown.
-		if strings.Contains(errMsg, "paused") {
-			if resumeErr := ResumeVM(vmName); resumeErr != nil {
-				return fmt.Errorf("failed to resume paused VM '%s': %w", vmName, resumeErr)
-			}
-			// Retry shutdown after resuming.
-			err = shutdown(vmName)
-			errMsg = strings.ToLower(err.Error())
-			if err != nil && (!strings.Contains(errMsg, "not currently running") && !strings.Contains(errMsg, "aborted")) {
-				return fmt.Errorf("error shutting down VM '%s' after resuming: %w", vmName, err)
-			}
+// SaveStateVM saves the state of a running or paused VirtualBox VM and stops it.
+func SaveStateVM(ctx context.Context, runner Runner, vmName string) error {
+	if _, stderr, err := runner.Run(ctx, "controlvm", vmName, "savestate"); err != nil {
+		return fmt.Errorf("error saving state of VM '%s': %w: %s", vmName, err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// ShutdownVM powers off a VM, first resuming it if it is paused.
+// If the VM is not running (powered off, saved or aborted), it treats that as success.
+func ShutdownVM(ctx context.Context, runner Runner, vmName string) error {
+	info, err := ShowVMInfo(ctx, runner, vmName)
+	if err != nil {
+		return fmt.Errorf("error shutting down VM '%s': %w", vmName, err)
+	}
+	if info.State.IsOff() {
+		return nil
+	}
+	if info.State == vmTypes.StatePaused {
+		if err := ResumeVM(ctx, runner, vmName); err != nil {
+			return fmt.Errorf("failed to resume paused VM '%s': %w", vmName, err)
+		}
+	}
+	if err := shutdown(ctx, runner, vmName); err != nil {
+		// The VM may have stopped on its own since its state was queried.
+		if strings.Contains(strings.ToLower(err.Error()), "not currently running") {
 			return nil
 		}
 		return fmt.Errorf("error shutting down VM '%s': %w", vmName, err)
@@ -65,12 +82,9 @@ func ShutdownVM(vmName string) error {
 }
 
 // shutdown is a helper that issues the poweroff command and captures error output.
-func shutdown(vmName string) error {
-	var out bytes.Buffer
-	cmd := exec.Command("VBoxManage", "controlvm", vmName, "poweroff")
-	cmd.Stderr = &out
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("%v: %s", err, out.String())
+func shutdown(ctx context.Context, runner Runner, vmName string) error {
+	if _, stderr, err := runner.Run(ctx, "controlvm", vmName, "poweroff"); err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
 	}
 	return nil
 }
@@ -0,0 +1,245 @@
+package vboxOperations
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"vnecro/redact"
+	"vnecro/vmTypes"
+)
+
+// replay returns a ReplayRunner for the transcript testdata/<name>.
+func replay(t *testing.T, name string) *ReplayRunner {
+	t.Helper()
+	runner, err := NewReplayRunner(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+// assertReplayed fails the test unless every entry of the transcript was used.
+func assertReplayed(t *testing.T, runner *ReplayRunner) {
+	t.Helper()
+	for i, used := range runner.used {
+		if !used {
+			t.Errorf("transcript entry %d was not replayed: VBoxManage %v", i, runner.entries[i].Args)
+		}
+	}
+}
+
+func TestShowVMInfo(t *testing.T) {
+	runner := replay(t, "showvminfo.json")
+	info, err := ShowVMInfo(context.Background(), runner, "ubuntu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReplayed(t, runner)
+
+	if info.State != vmTypes.StateRunning || info.OSType != "Ubuntu (64-bit)" || info.MemoryMB != 4096 || info.CPUs != 2 {
+		t.Errorf("unexpected VM info: %+v", info)
+	}
+	want := []vmTypes.NIC{
+		{Index: 1, Attachment: "nat", MACAddress: "080027AAAAAA"},
+		{Index: 2, Attachment: "bridged", Network: "eth0", MACAddress: "080027BBBBBB"},
+		{Index: 4, Attachment: "intnet", Network: "testnet", MACAddress: "080027DDDDDD"},
+	}
+	if !slices.Equal(info.NICs, want) {
+		t.Errorf("NICs = %+v, want %+v", info.NICs, want)
+	}
+}
+
+func TestParseVMState(t *testing.T) {
+	tests := map[string]vmTypes.VMState{
+		"poweroff":          vmTypes.StatePowerOff,
+		"Running":           vmTypes.StateRunning,
+		" paused ":          vmTypes.StatePaused,
+		"saved":             vmTypes.StateSaved,
+		"aborted-saved":     vmTypes.StateSaved,
+		"aborted":           vmTypes.StateAborted,
+		"gurumeditation":    vmTypes.StateStuck,
+		"livesnapshotting":  vmTypes.StateSnapshot,
+		"restoringsnapshot": vmTypes.StateRestoring,
+		"settingup":         vmTypes.StateStarting,
+		"":                  vmTypes.StateUnknown,
+		"somethingnew":      vmTypes.StateUnknown,
+	}
+	for value, want := range tests {
+		if got := parseVMState(value); got != want {
+			t.Errorf("parseVMState(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestListSnapshots(t *testing.T) {
+	runner := replay(t, "snapshots.json")
+	tree, err := ListSnapshots(context.Background(), runner, "ubuntu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReplayed(t, runner)
+
+	var names []string
+	for _, s := range tree.All() {
+		names = append(names, s.Name)
+	}
+	if want := []string{"Base", "Setup", "Setup-A", "Setup-B", "Other"}; !slices.Equal(names, want) {
+		t.Fatalf("snapshots = %v, want %v", names, want)
+	}
+	setup := tree.FindByName("Setup")[0]
+	if setup.Parent == nil || setup.Parent.Name != "Base" || len(setup.Children) != 2 || setup.Description != "packages installed" {
+		t.Errorf("unexpected 'Setup' snapshot: %+v", setup)
+	}
+	if current := tree.Current(); current == nil || current.Name != "Setup-B" {
+		t.Errorf("current snapshot = %v, want Setup-B", current)
+	}
+	// Timestamps come from the settings file named by the VM info.
+	if latest := tree.Latest(); latest == nil || latest.Name != "Setup-B" {
+		t.Errorf("latest snapshot = %v, want Setup-B", latest)
+	}
+	if ts := tree.FindByName("Other")[0].TimeStamp; !ts.Equal(time.Date(2026, 10, 4, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("timestamp of 'Other' = %s", ts)
+	}
+}
+
+func TestListSnapshotsWithoutSnapshots(t *testing.T) {
+	runner := replay(t, "no_snapshots.json")
+	tree, err := ListSnapshots(context.Background(), runner, "ubuntu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertReplayed(t, runner)
+	if len(tree.All()) != 0 {
+		t.Errorf("expected an empty tree, got %d snapshots", len(tree.All()))
+	}
+}
+
+func TestShutdownVM(t *testing.T) {
+	tests := []struct {
+		transcript string
+		wantErr    string
+	}{
+		// An aborted VM is already off, so nothing is powered off.
+		{transcript: "shutdown_off.json"},
+		// A paused VM is resumed before it is powered off.
+		{transcript: "shutdown_paused.json"},
+		// The VM stopped on its own between the state query and the poweroff.
+		{transcript: "shutdown_race.json"},
+		{transcript: "shutdown_locked.json", wantErr: "locked for a session"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.transcript, func(t *testing.T) {
+			runner := replay(t, tt.transcript)
+			err := ShutdownVM(context.Background(), runner, "ubuntu")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+			assertReplayed(t, runner)
+		})
+	}
+}
+
+func TestReplayRunnerRejectsUnknownCall(t *testing.T) {
+	runner := replay(t, "shutdown_off.json")
+	if _, _, err := runner.Run(context.Background(), "startvm", "ubuntu", "--type", "headless"); err == nil {
+		t.Fatal("expected an error for a call that is not in the transcript")
+	}
+}
+
+func TestMaskArgs(t *testing.T) {
+	got := maskArgs([]string{
+		"guestcontrol", "ubuntu", "copyfrom",
+		"--username", "user",
+		"--passwordfile", "/tmp/vnecro-password-123456",
+		"--target-directory", "artifacts/20261018-065233/smoke",
+		"--", "/tmp/vnecro-script-987654/script",
+	})
+	want := []string{
+		"guestcontrol", "ubuntu", "copyfrom",
+		"--username", "user",
+		"--passwordfile", "****",
+		"--target-directory", "artifacts/<run>/smoke",
+		"--", "$TMPDIR/vnecro-script-*/script",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("maskArgs = %q, want %q", got, want)
+	}
+}
+
+// stubRunner answers every command with the same output.
+type stubRunner struct {
+	stdout string
+}
+
+func (s stubRunner) Run(ctx context.Context, args ...string) (string, string, error) {
+	return s.stdout, "", nil
+}
+
+func (s stubRunner) RunStreaming(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
+	_, err := io.WriteString(stdout, s.stdout)
+	return err
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.json")
+	recorder := NewRecordingRunner(stubRunner{stdout: "0123456789"}, path)
+	t.Cleanup(func() { recorder.Close() })
+	capture := vmTypes.GuestCommand{MaxOutputBytes: 4}.NewCapture("stdout")
+	if err := recorder.RunStreaming(context.Background(), capture, io.Discard,
+		"guestcontrol", "ubuntu", "copyfrom", "--target-directory", "artifacts/20261018-065233/smoke"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later run uses another artifacts directory.
+	player, err := NewReplayRunner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err := player.Run(context.Background(), "guestcontrol", "ubuntu", "copyfrom", "--target-directory", "artifacts/20261019-101010/smoke")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The recording keeps no more output than the capture did.
+	if stdout != "0123" {
+		t.Errorf("replayed stdout = %q, want %q", stdout, "0123")
+	}
+	if _, _, err := player.Run(context.Background(), "startvm", "ubuntu"); err == nil || errors.Is(err, context.Canceled) {
+		t.Errorf("expected an error for an unrecorded call, got %v", err)
+	}
+}
+
+func TestRecordingRunnerClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.json")
+	recorder := NewRecordingRunner(stubRunner{stdout: "token-before-close"}, path)
+	if _, _, err := recorder.Run(context.Background(), "list", "vms"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A secret added while the recorder is open is masked in the transcript.
+	redact.Add("token-before-close")
+	if data, err := os.ReadFile(path); err != nil || strings.Contains(string(data), "token-before-close") {
+		t.Fatalf("transcript was not rewritten: %s (%v)", data, err)
+	}
+
+	// After Close, the transcript is left alone.
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	redact.Add("token-after-close")
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("closed recorder rewrote its transcript: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package vboxOperations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// DefaultVBoxManagePath is the VBoxManage binary used when no path is configured;
+// it is looked up in PATH.
+const DefaultVBoxManagePath = "VBoxManage"
+
+// Runner runs VBoxManage commands. Every function in this package goes through a Runner,
+// so the commands can be retargeted at another binary, recorded, or replayed from a transcript.
+type Runner interface {
+	// Run runs VBoxManage with the given arguments and returns what it printed.
+	// If VBoxManage exits with a non-zero status, the output is returned along with an *ExitError.
+	Run(ctx context.Context, args ...string) (stdout, stderr string, err error)
+	// RunStreaming runs VBoxManage like Run, but writes its output to stdout and stderr
+	// while it runs.
+	RunStreaming(ctx context.Context, stdout, stderr io.Writer, args ...string) error
+}
+
+// ExitError reports that VBoxManage, or the guest process it ran, exited with a non-zero status.
+type ExitError struct {
+	Code int
+}
+
+// Error formats the exit status like os/exec does.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExecRunner runs a VBoxManage binary as a child process.
+type ExecRunner struct {
+	// Path is the VBoxManage binary; empty means DefaultVBoxManagePath.
+	Path string
+}
+
+// NewExecRunner returns a Runner that executes the VBoxManage binary at path,
+// or the one in PATH if path is empty.
+func NewExecRunner(path string) *ExecRunner {
+	return &ExecRunner{Path: path}
+}
+
+// Run executes VBoxManage and converts a non-zero exit into an *ExitError.
+// Cancelling the context kills the process.
+func (r *ExecRunner) Run(ctx context.Context, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := r.RunStreaming(ctx, &stdout, &stderr, args...)
+	return stdout.String(), stderr.String(), err
+}
+
+// RunStreaming executes VBoxManage with its output connected to stdout and stderr.
+func (r *ExecRunner) RunStreaming(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
+	path := r.Path
+	if path == "" {
+		path = DefaultVBoxManagePath
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		err = &ExitError{Code: exitErr.ExitCode()}
+	}
+	return err
+}
+
+// exitCode returns the exit status carried by err, if it is an *ExitError.
+func exitCode(err error) (int, bool) {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code, true
+	}
+	return 0, false
+}
@@ -1,18 +1,19 @@
 package vboxOperations
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"vnecro/vmTypes"
 )
 
 // WaitForGuestExecReady polls the guest execution service by trying to run a simple echo command.
-// It will keep retrying until the command succeeds or the timeout is reached, printing a logrus message each second.
-func WaitForGuestExecReady(vmName, username, password string, timeout time.Duration) error {
+// It will keep retrying until the command succeeds, the timeout is reached or the context is cancelled,
+// printing a logrus message each second.
+func WaitForGuestExecReady(ctx context.Context, runner Runner, vmName, username, password string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	// Ensure the dummy command uses an absolute path.
 	exe := "echo"
@@ -22,54 +23,61 @@ func WaitForGuestExecReady(vmName, username, password string, timeout time.Durat
 
 	currentSecond := 0
 	for {
-		// Build the command to check guest readiness.
-		cmdArgs := []string{
-			"guestcontrol", vmName, "run",
-			"--username", username,
-			"--password", password,
-			"--exe", exe,
-			"--", "ready",
-		}
-		cmd := exec.Command("VBoxManage", cmdArgs...)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		err := cmd.Run()
+		// Run a dummy command to check guest readiness.
+		stdout, _, err := runGuestControl(ctx, runner, vmName, "run", username, password, "--exe", exe, "--", "ready")
 		if err == nil {
 			// Command succeeded; guest execution service is ready.
 			return nil
 		}
+		// Give up as soon as the caller cancels.
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped waiting for guest execution service: %w", ctx.Err())
+		}
 		// If we've passed the deadline, return a timeout error.
 		if time.Now().After(deadline) {
-			return fmt.Errorf("timeout waiting for guest execution service to be ready: last error: %v, output: %s", err, out.String())
+			return fmt.Errorf("timeout waiting for guest execution service to be ready: last error: %v, output: %s", err, stdout)
 		}
 		// Print a waiting message every second.
 		logrus.Printf("Waiting for guest execution service to be ready on VM '%s' (%d / %d seconds)", vmName, currentSecond, int(timeout.Seconds()))
 		currentSecond++
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for guest execution service: %w", ctx.Err())
+		case <-time.After(1 * time.Second):
+		}
 	}
 }
 
-// ExecuteShellCommand executes a shell command inside the guest OS.
-// It uses VBoxManage guestcontrol run and requires Guest Additions to be installed.
-func ExecuteShellCommand(vmName, username, password, command string, args ...string) (string, error) {
-	// If the command does not start with "/", assume it's in /bin/ and prepend it.
-	if len(command) > 0 && command[0] != '/' {
-		command = "/bin/" + command
+// ExecuteShellCommand executes a command inside the guest OS and returns its
+// stdout, stderr, exit code and duration. VBoxManage guestcontrol run exits with the
+// guest process's exit code, so a non-zero exit is reported in the result rather than
+// as an error; an error is returned only if VBoxManage itself fails to run the command.
+// The output is passed to cmd.OnOutput line by line while the command runs.
+// It requires Guest Additions to be installed.
+func ExecuteShellCommand(ctx context.Context, runner Runner, vmName, username, password string, cmd vmTypes.GuestCommand) (*vmTypes.CommandResult, error) {
+	exe, args := cmd.Argv()
+	var cmdArgs []string
+	for _, variable := range cmd.Env {
+		cmdArgs = append(cmdArgs, "--putenv", variable)
 	}
-
-	cmdArgs := []string{
-		"guestcontrol", vmName, "run",
-		"--username", username,
-		"--password", password,
-		"--exe", command,
-		"--",
+	if cmd.Cwd != "" {
+		cmdArgs = append(cmdArgs, "--cwd", cmd.Cwd)
 	}
+	cmdArgs = append(cmdArgs, "--exe", exe, "--")
 	cmdArgs = append(cmdArgs, args...)
 
-	cmd := exec.Command("VBoxManage", cmdArgs...)
-	output, err := cmd.CombinedOutput()
+	start := time.Now()
+	stdout, stderr := cmd.NewCapture("stdout"), cmd.NewCapture("stderr")
+	err := streamGuestControl(ctx, runner, stdout, stderr, vmName, "run", username, password, cmdArgs...)
+	result := vmTypes.NewCommandResult(stdout, stderr, time.Since(start))
 	if err != nil {
-		return "", fmt.Errorf("error executing shell command: %v, output: %s", err, output)
+		code, exited := exitCode(err)
+		// VBoxManage reports its own failures (e.g. bad credentials) with an
+		// error prefix on stderr; anything else is the guest process exiting.
+		if ctx.Err() != nil || !exited || strings.Contains(result.Stderr, "VBoxManage: error:") {
+			return nil, fmt.Errorf("error executing shell command: %v, output: %s", err, strings.TrimSpace(result.Stderr))
+		}
+		result.ExitCode = code
 	}
-	return string(output), nil
+	return result, nil
 }
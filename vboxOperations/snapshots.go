@@ -1,48 +1,183 @@
 package vboxOperations
 
 import (
-	"bytes"
+	"context"
+	"encoding/xml"
 	"fmt"
-	"os/exec"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/vmTypes"
 )
 
-// ListSnapshots lists snapshots for a given VM and returns the raw output.
-func ListSnapshots(vmName string) (string, error) {
-	cmd := exec.Command("VBoxManage", "snapshot", vmName, "list", "--details")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("error listing snapshots: %w", err)
-	}
-	return out.String(), nil
-}
-
-// ParseSnapshot extracts a clean snapshot name from the given raw snapshot listing.
-// It expects lines like: "Name: InitialInstallation (UUID: ...)" and returns "InitialInstallation".
-func ParseSnapshot(snapshotOutput string) (string, error) {
-	lines := strings.Split(snapshotOutput, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "Name:") {
-			// Remove the "Name:" prefix and trim spaces.
-			nameLine := strings.TrimSpace(strings.TrimPrefix(line, "Name:"))
-			// Split on " (" to remove the UUID and any extra markers.
-			if idx := strings.Index(nameLine, " ("); idx != -1 {
-				return nameLine[:idx], nil
+// ListSnapshots lists the snapshots of a given VM as a tree.
+// Timestamps are read from the VM's settings file on a best-effort basis,
+// since VBoxManage does not report them.
+func ListSnapshots(ctx context.Context, runner Runner, vmName string) (*vmTypes.SnapshotTree, error) {
+	stdout, stderr, err := runner.Run(ctx, "snapshot", vmName, "list", "--machinereadable")
+	if err != nil {
+		// VBoxManage fails when the VM has no snapshots at all.
+		if strings.Contains(stdout+stderr, "does not have any snapshots") {
+			return &vmTypes.SnapshotTree{}, nil
+		}
+		return nil, fmt.Errorf("error listing snapshots: %w: %s", err, strings.TrimSpace(stderr))
+	}
+
+	tree, err := ParseSnapshotList(stdout)
+	if err != nil {
+		return nil, err
+	}
+	if err := addSnapshotTimeStamps(ctx, runner, vmName, tree); err != nil {
+		logrus.Debugf("Snapshot timestamps unavailable for VM '%s': %v", vmName, err)
+	}
+	return tree, nil
+}
+
+// ParseSnapshotList builds a snapshot tree from the output of
+// "VBoxManage snapshot <vm> list --machinereadable". Snapshots are keyed by
+// their position in the tree: "SnapshotName" is the root, "SnapshotName-1" its
+// first child, "SnapshotName-1-2" that child's second child, and so on.
+func ParseSnapshotList(output string) (*vmTypes.SnapshotTree, error) {
+	values := parseMachineReadable(output)
+
+	// Collect the tree paths ("", "-1", "-1-2", ...) of all listed snapshots.
+	var paths []string
+	for key := range values {
+		if strings.HasPrefix(key, "SnapshotName") {
+			paths = append(paths, strings.TrimPrefix(key, "SnapshotName"))
+		}
+	}
+	if len(paths) == 0 {
+		return &vmTypes.SnapshotTree{}, nil
+	}
+	sort.Slice(paths, func(i, j int) bool { return lessSnapshotPath(paths[i], paths[j]) })
+
+	tree := &vmTypes.SnapshotTree{}
+	nodes := make(map[string]*vmTypes.Snapshot, len(paths))
+	currentUUID, currentNode := values["CurrentSnapshotUUID"], values["CurrentSnapshotNode"]
+	for _, path := range paths {
+		snapshot := &vmTypes.Snapshot{
+			Name:        values["SnapshotName"+path],
+			UUID:        values["SnapshotUUID"+path],
+			Description: values["SnapshotDescription"+path],
+		}
+		if currentUUID != "" {
+			snapshot.Current = snapshot.UUID == currentUUID
+		} else {
+			snapshot.Current = "SnapshotName"+path == currentNode
+		}
+		nodes[path] = snapshot
+
+		if path == "" {
+			tree.Roots = append(tree.Roots, snapshot)
+			continue
+		}
+		parentPath := path[:strings.LastIndex(path, "-")]
+		parent, ok := nodes[parentPath]
+		if !ok {
+			return nil, fmt.Errorf("snapshot '%s' has no parent in the listing", snapshot.Name)
+		}
+		snapshot.Parent = parent
+		parent.Children = append(parent.Children, snapshot)
+	}
+	return tree, nil
+}
+
+// lessSnapshotPath orders tree paths so that parents precede their children
+// and siblings appear in numeric order.
+func lessSnapshotPath(a, b string) bool {
+	as, bs := strings.Split(a, "-")[1:], strings.Split(b, "-")[1:]
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ai, _ := strconv.Atoi(as[i])
+		bi, _ := strconv.Atoi(bs[i])
+		if ai != bi {
+			return ai < bi
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// vboxSettings mirrors the parts of a VM's .vbox settings file needed to read snapshot timestamps.
+type vboxSettings struct {
+	Machine struct {
+		Snapshots []vboxSnapshotSettings `xml:"Snapshot"`
+	} `xml:"Machine"`
+}
+
+// vboxSnapshotSettings is a <Snapshot> element of a .vbox settings file.
+type vboxSnapshotSettings struct {
+	UUID      string                 `xml:"uuid,attr"`
+	TimeStamp string                 `xml:"timeStamp,attr"`
+	Children  []vboxSnapshotSettings `xml:"Snapshots>Snapshot"`
+}
+
+// addSnapshotTimeStamps fills in the snapshot timestamps from the VM's settings file.
+func addSnapshotTimeStamps(ctx context.Context, runner Runner, vmName string, tree *vmTypes.SnapshotTree) error {
+	stdout, _, err := runner.Run(ctx, "showvminfo", vmName, "--machinereadable")
+	if err != nil {
+		return fmt.Errorf("error reading VM info: %w", err)
+	}
+	cfgFile := parseMachineReadable(stdout)["CfgFile"]
+	if cfgFile == "" {
+		return fmt.Errorf("VM info does not name a settings file")
+	}
+
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return err
+	}
+	var settings vboxSettings
+	if err := xml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("error parsing settings file '%s': %w", cfgFile, err)
+	}
+
+	var walk func(nodes []vboxSnapshotSettings)
+	walk = func(nodes []vboxSnapshotSettings) {
+		for _, node := range nodes {
+			if s := tree.FindByUUID(node.UUID); s != nil {
+				if ts, err := time.Parse(time.RFC3339, node.TimeStamp); err == nil {
+					s.TimeStamp = ts
+				}
 			}
-			return nameLine, nil
+			walk(node.Children)
 		}
 	}
-	return "", fmt.Errorf("no snapshot found")
+	walk(settings.Machine.Snapshots)
+	return nil
+}
+
+// RestoreSnapshot restores the given VM to the specified snapshot, given by name or UUID.
+func RestoreSnapshot(ctx context.Context, runner Runner, vmName, snapshot string) error {
+	if _, stderr, err := runner.Run(ctx, "snapshot", vmName, "restore", snapshot); err != nil {
+		return fmt.Errorf("error restoring snapshot '%s': %w: %s", snapshot, err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// TakeSnapshot takes a snapshot of the given VM with an optional description.
+// If live is true, the snapshot is taken without pausing the running VM.
+func TakeSnapshot(ctx context.Context, runner Runner, vmName, name, description string, live bool) error {
+	cmdArgs := []string{"snapshot", vmName, "take", name}
+	if description != "" {
+		cmdArgs = append(cmdArgs, "--description", description)
+	}
+	if live {
+		cmdArgs = append(cmdArgs, "--live")
+	}
+	if _, stderr, err := runner.Run(ctx, cmdArgs...); err != nil {
+		return fmt.Errorf("error taking snapshot '%s': %w: %s", name, err, strings.TrimSpace(stderr))
+	}
+	return nil
 }
 
-// RestoreSnapshot restores the given VM to the specified snapshot.
-func RestoreSnapshot(vmName, snapshot string) error {
-	cmd := exec.Command("VBoxManage", "snapshot", vmName, "restore", snapshot)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error restoring snapshot '%s': %w", snapshot, err)
+// DeleteSnapshot deletes the specified snapshot, given by name or UUID, from the given VM.
+func DeleteSnapshot(ctx context.Context, runner Runner, vmName, snapshot string) error {
+	if _, stderr, err := runner.Run(ctx, "snapshot", vmName, "delete", snapshot); err != nil {
+		return fmt.Errorf("error deleting snapshot '%s': %w: %s", snapshot, err, strings.TrimSpace(stderr))
 	}
 	return nil
 }
@@ -0,0 +1,82 @@
+package vboxOperations
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vnecro/vmTypes"
+)
+
+// vboxStates maps VirtualBox VMState values to VM states where the names differ.
+var vboxStates = map[string]vmTypes.VMState{
+	"gurumeditation":         vmTypes.StateStuck,
+	"livesnapshotting":       vmTypes.StateSnapshot,
+	"onlinesnapshotting":     vmTypes.StateSnapshot,
+	"deletingsnapshot":       vmTypes.StateSnapshot,
+	"deletingsnapshotlive":   vmTypes.StateSnapshot,
+	"deletingsnapshotpaused": vmTypes.StateSnapshot,
+	"restoringsnapshot":      vmTypes.StateRestoring,
+	"settingup":              vmTypes.StateStarting,
+	"aborted-saved":          vmTypes.StateSaved,
+}
+
+// ShowVMInfo queries the state and hardware of a VM with "VBoxManage showvminfo --machinereadable".
+func ShowVMInfo(ctx context.Context, runner Runner, vmName string) (*vmTypes.VMInfo, error) {
+	stdout, stderr, err := runner.Run(ctx, "showvminfo", vmName, "--machinereadable")
+	if err != nil {
+		return nil, fmt.Errorf("error reading info of VM '%s': %w: %s", vmName, err, strings.TrimSpace(stderr))
+	}
+	return ParseVMInfo(stdout), nil
+}
+
+// ParseVMInfo extracts the state and hardware of a VM from the output of
+// "VBoxManage showvminfo <vm> --machinereadable".
+func ParseVMInfo(output string) *vmTypes.VMInfo {
+	values := parseMachineReadable(output)
+	info := &vmTypes.VMInfo{
+		State:  parseVMState(values["VMState"]),
+		OSType: values["ostype"],
+	}
+	info.MemoryMB, _ = strconv.Atoi(values["memory"])
+	info.CPUs, _ = strconv.Atoi(values["cpus"])
+
+	// Adapters are numbered nic1, nic2, ...; unused slots are "none".
+	for i := 1; ; i++ {
+		attachment, ok := values[fmt.Sprintf("nic%d", i)]
+		if !ok {
+			break
+		}
+		if attachment == "none" {
+			continue
+		}
+		nic := vmTypes.NIC{
+			Index:      i,
+			Attachment: attachment,
+			MACAddress: values[fmt.Sprintf("macaddress%d", i)],
+		}
+		for _, key := range []string{"bridgeadapter", "intnet", "hostonlyadapter", "nat-network"} {
+			if network := values[fmt.Sprintf("%s%d", key, i)]; network != "" {
+				nic.Network = network
+				break
+			}
+		}
+		info.NICs = append(info.NICs, nic)
+	}
+	return info
+}
+
+// parseVMState converts a VirtualBox VMState value into a VM state.
+func parseVMState(value string) vmTypes.VMState {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if state, ok := vboxStates[value]; ok {
+		return state
+	}
+	for _, state := range vmTypes.KnownStates {
+		if string(state) == value {
+			return state
+		}
+	}
+	return vmTypes.StateUnknown
+}
@@ -0,0 +1,241 @@
+package vboxOperations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/redact"
+)
+
+// maskedArgs lists the VBoxManage options whose values are secrets, or password
+// files that differ on every run, and are never written to a transcript.
+var maskedArgs = []string{"--password", "--passwordfile"}
+
+// volatileArgs rewrites the parts of arguments that differ on every run, so that a
+// transcript recorded by one run can be replayed by another.
+var volatileArgs = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Host temporary files and directories, created with os.CreateTemp or os.MkdirTemp
+	// and a "vnecro-<kind>-*" pattern, e.g. RunScript's inline scripts.
+	{regexp.MustCompile(`^(?:.*/)?vnecro-([a-z]+)-\d+`), "$$TMPDIR/vnecro-$1-*"},
+	// The run's artifacts directory, <artifacts_dir>/<YYYYMMDD-HHMMSS>/<job>, e.g. the
+	// target directory of CopyFromGuest.
+	{regexp.MustCompile(`(^|/)\d{8}-\d{6}(/|$)`), "${1}<run>${2}"},
+}
+
+// TranscriptEntry is one recorded VBoxManage invocation.
+type TranscriptEntry struct {
+	Args     []string `json:"args"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	ExitCode int      `json:"exit_code,omitempty"`
+	// Error holds a failure to run VBoxManage at all, e.g. a missing binary.
+	Error string `json:"error,omitempty"`
+}
+
+// maskArgs returns a copy of args with the values of secret options replaced by "****"
+// and volatile parts normalized as described by volatileArgs. Transcripts store masked
+// arguments, and replayed commands are matched by them.
+func maskArgs(args []string) []string {
+	masked := slices.Clone(args)
+	for i := 0; i < len(masked); i++ {
+		if slices.Contains(maskedArgs, masked[i]) && i+1 < len(masked) {
+			masked[i+1] = "****"
+			i++
+			continue
+		}
+		for _, volatile := range volatileArgs {
+			masked[i] = volatile.pattern.ReplaceAllString(masked[i], volatile.replacement)
+		}
+	}
+	return masked
+}
+
+// RecordingRunner passes every command to another Runner and records it,
+// rewriting the transcript file after each call so it survives an interrupted run.
+type RecordingRunner struct {
+	runner  Runner
+	path    string
+	mu      sync.Mutex
+	entries []TranscriptEntry
+	// unregister stops rewriting the transcript when secrets are added.
+	unregister func()
+}
+
+// NewRecordingRunner returns a Runner that records the commands run by runner to the JSON file at path.
+// Secrets known to package redact are masked in the recorded output, and the transcript is rewritten
+// whenever a new secret is added, since the output of a sensitive operation is only registered after
+// the command that printed it. Call Close once the runner is no longer used.
+func NewRecordingRunner(runner Runner, path string) *RecordingRunner {
+	r := &RecordingRunner{runner: runner, path: path}
+	r.unregister = redact.OnAdd(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err := r.write(); err != nil {
+			logrus.Warnf("Failed to rewrite transcript '%s': %v", r.path, err)
+		}
+	})
+	return r
+}
+
+// Close stops rewriting the transcript when new secrets are added.
+func (r *RecordingRunner) Close() error {
+	r.unregister()
+	return nil
+}
+
+// Run runs the command and appends it, with its output, to the transcript.
+func (r *RecordingRunner) Run(ctx context.Context, args ...string) (string, string, error) {
+	stdout, stderr, err := r.runner.Run(ctx, args...)
+	return stdout, stderr, r.record(args, stdout, stderr, err)
+}
+
+// RunStreaming runs the command, passing its output on while also recording it.
+// If the writers limit how much output they keep, so does the recording.
+func (r *RecordingRunner) RunStreaming(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
+	stdoutCopy, stderrCopy := newCappedBuffer(stdout), newCappedBuffer(stderr)
+	err := r.runner.RunStreaming(ctx, io.MultiWriter(stdout, stdoutCopy), io.MultiWriter(stderr, stderrCopy), args...)
+	return r.record(args, stdoutCopy.String(), stderrCopy.String(), err)
+}
+
+// limiter is implemented by writers that keep at most Limit bytes, such as
+// vmTypes.OutputCapture; 0 means no limit.
+type limiter interface {
+	Limit() int
+}
+
+// cappedBuffer is a buffer that silently drops output beyond its limit.
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+// newCappedBuffer returns a buffer with the limit of w, if it has one.
+func newCappedBuffer(w io.Writer) *cappedBuffer {
+	b := &cappedBuffer{}
+	if l, ok := w.(limiter); ok {
+		b.limit = l.Limit()
+	}
+	return b
+}
+
+// Write keeps as much of p as fits under the limit and reports it all as written.
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	kept := p
+	if b.limit > 0 {
+		kept = kept[:min(len(kept), max(b.limit-b.buf.Len(), 0))]
+	}
+	b.buf.Write(kept)
+	return len(p), nil
+}
+
+// String returns the kept output.
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
+
+// record appends a command to the transcript and returns the command's error,
+// joined with any error writing the transcript.
+func (r *RecordingRunner) record(args []string, stdout, stderr string, err error) error {
+	entry := TranscriptEntry{Args: maskArgs(args), Stdout: stdout, Stderr: stderr}
+	if code, ok := exitCode(err); ok {
+		entry.ExitCode = code
+	} else if err != nil {
+		entry.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	if writeErr := r.write(); writeErr != nil {
+		return errors.Join(err, fmt.Errorf("error writing transcript '%s': %w", r.path, writeErr))
+	}
+	return err
+}
+
+// write rewrites the transcript file, readable only by the current user, with the
+// output of every entry redacted. The caller must hold r.mu.
+func (r *RecordingRunner) write() error {
+	redacted := make([]TranscriptEntry, len(r.entries))
+	for i, entry := range r.entries {
+		entry.Stdout = redact.String(entry.Stdout)
+		entry.Stderr = redact.String(entry.Stderr)
+		entry.Error = redact.String(entry.Error)
+		redacted[i] = entry
+	}
+	data, err := json.MarshalIndent(redacted, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file.
+	return os.Chmod(r.path, 0o600)
+}
+
+// ReplayRunner answers commands from a recorded transcript instead of running VBoxManage.
+// Each command is answered by the first unused entry with the same arguments, so commands
+// of concurrent jobs may interleave differently than when they were recorded.
+type ReplayRunner struct {
+	mu      sync.Mutex
+	entries []TranscriptEntry
+	used    []bool
+}
+
+// NewReplayRunner loads the JSON transcript at path.
+func NewReplayRunner(path string) (*ReplayRunner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading transcript: %w", err)
+	}
+	var entries []TranscriptEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing transcript '%s': %w", path, err)
+	}
+	return &ReplayRunner{entries: entries, used: make([]bool, len(entries))}, nil
+}
+
+// RunStreaming writes the recorded output of the command to stdout and stderr.
+func (r *ReplayRunner) RunStreaming(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
+	out, errOut, err := r.Run(ctx, args...)
+	io.WriteString(stdout, out)
+	io.WriteString(stderr, errOut)
+	return err
+}
+
+// Run returns the recorded output of the command, or an error if the transcript has no unused entry for it.
+func (r *ReplayRunner) Run(ctx context.Context, args ...string) (string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	masked := maskArgs(args)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, entry := range r.entries {
+		if r.used[i] || !slices.Equal(entry.Args, masked) {
+			continue
+		}
+		r.used[i] = true
+		switch {
+		case entry.Error != "":
+			return entry.Stdout, entry.Stderr, errors.New(entry.Error)
+		case entry.ExitCode != 0:
+			return entry.Stdout, entry.Stderr, &ExitError{Code: entry.ExitCode}
+		}
+		return entry.Stdout, entry.Stderr, nil
+	}
+	return "", "", fmt.Errorf("transcript has no recorded call for: VBoxManage %v", masked)
+}
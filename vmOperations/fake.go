@@ -0,0 +1,526 @@
+package vmOperations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vnecro/config"
+	"vnecro/vmTypes"
+)
+
+// fakeVM is the in-memory state of one simulated VM.
+type fakeVM struct {
+	state vmTypes.VMState
+	tree  *vmTypes.SnapshotTree
+	// snapshotStates holds the power state each snapshot restores the VM to.
+	snapshotStates map[*vmTypes.Snapshot]vmTypes.VMState
+	// files maps guest paths to file contents.
+	files map[string][]byte
+	// ignoreACPI makes the guest ignore the ACPI power button.
+	ignoreACPI bool
+}
+
+// FakeOperator is an in-memory implementation of VMOperator for dry-running job configurations
+// without a hypervisor. It simulates power state transitions, a snapshot tree per VM, a guest
+// file system, and guest commands whose responses are scripted in the configuration.
+// VMs not declared in the configuration start powered off, without snapshots.
+type FakeOperator struct {
+	mu       sync.Mutex
+	vms      map[string]*fakeVM
+	commands []config.FakeCommand
+	nextUUID int
+}
+
+// NewFakeOperator returns a new instance of FakeOperator seeded from the fake section of the configuration.
+func NewFakeOperator(cfg config.FakeConfig) (VMOperator, error) {
+	f := &FakeOperator{
+		vms:      make(map[string]*fakeVM),
+		commands: cfg.Commands,
+	}
+	// Declared snapshots get increasing timestamps in declaration order, in the past.
+	stamp := time.Now().Add(-24 * time.Hour)
+	for _, declared := range cfg.VMs {
+		if _, dup := f.vms[declared.VMName]; dup {
+			return nil, fmt.Errorf("fake VM '%s' is declared more than once", declared.VMName)
+		}
+		vm := f.newVM()
+		vm.ignoreACPI = declared.IgnoreACPI
+		if declared.State != "" {
+			vm.state = vmTypes.VMState(declared.State)
+		}
+		var add func(parent *vmTypes.Snapshot, snapshots []config.FakeSnapshot)
+		add = func(parent *vmTypes.Snapshot, snapshots []config.FakeSnapshot) {
+			for _, s := range snapshots {
+				stamp = stamp.Add(time.Minute)
+				snapshot := &vmTypes.Snapshot{
+					Name:        s.Name,
+					UUID:        s.UUID,
+					Description: s.Description,
+					TimeStamp:   stamp,
+				}
+				if snapshot.UUID == "" {
+					snapshot.UUID = f.newUUID()
+				}
+				f.attach(vm, parent, snapshot, vmTypes.StatePowerOff)
+				add(snapshot, s.Children)
+			}
+		}
+		add(nil, declared.Snapshots)
+		if declared.CurrentSnapshot != "" {
+			current, err := findFakeSnapshot(vm, declared.CurrentSnapshot)
+			if err != nil {
+				return nil, fmt.Errorf("fake VM '%s': %w", declared.VMName, err)
+			}
+			current.Current = true
+		}
+		for guestPath, content := range declared.Files {
+			vm.files[path.Clean(guestPath)] = []byte(content)
+		}
+		f.vms[declared.VMName] = vm
+	}
+	return f, nil
+}
+
+// newVM returns a powered off VM without snapshots or files.
+func (f *FakeOperator) newVM() *fakeVM {
+	return &fakeVM{
+		state:          vmTypes.StatePowerOff,
+		tree:           &vmTypes.SnapshotTree{},
+		snapshotStates: make(map[*vmTypes.Snapshot]vmTypes.VMState),
+		files:          make(map[string][]byte),
+	}
+}
+
+// newUUID returns a unique, UUID-shaped identifier for a simulated snapshot.
+func (f *FakeOperator) newUUID() string {
+	f.nextUUID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", f.nextUUID)
+}
+
+// attach adds a snapshot below parent, or as a root if parent is nil.
+func (f *FakeOperator) attach(vm *fakeVM, parent, snapshot *vmTypes.Snapshot, state vmTypes.VMState) {
+	snapshot.Parent = parent
+	if parent != nil {
+		parent.Children = append(parent.Children, snapshot)
+	} else {
+		vm.tree.Roots = append(vm.tree.Roots, snapshot)
+	}
+	vm.snapshotStates[snapshot] = state
+}
+
+// lock acquires the operator's lock and returns the named VM, creating it on first use.
+// The caller must unlock f.mu. It fails if the context is already cancelled.
+func (f *FakeOperator) lock(ctx context.Context, vmName string) (*fakeVM, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	vm, ok := f.vms[vmName]
+	if !ok {
+		vm = f.newVM()
+		f.vms[vmName] = vm
+	}
+	return vm, nil
+}
+
+// findFakeSnapshot looks a snapshot up by UUID, then by name.
+func findFakeSnapshot(vm *fakeVM, snapshot string) (*vmTypes.Snapshot, error) {
+	if found := vm.tree.FindByUUID(snapshot); found != nil {
+		return found, nil
+	}
+	if found := vm.tree.FindByName(snapshot); len(found) > 0 {
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("snapshot '%s' not found", snapshot)
+}
+
+// State returns the simulated power state of the VM; it has no hardware.
+func (f *FakeOperator) State(ctx context.Context, vmName string) (*vmTypes.VMInfo, error) {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.Unlock()
+	return &vmTypes.VMInfo{State: vm.state}, nil
+}
+
+// Start powers on a powered off, saved or aborted VM.
+func (f *FakeOperator) Start(ctx context.Context, vmName string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if !vm.state.IsOff() {
+		return fmt.Errorf("error starting VM '%s': VM is %s", vmName, vm.state)
+	}
+	vm.state = vmTypes.StateRunning
+	return nil
+}
+
+// Pause suspends a running VM.
+func (f *FakeOperator) Pause(ctx context.Context, vmName string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StateRunning {
+		return fmt.Errorf("error pausing VM '%s': VM is %s", vmName, vm.state)
+	}
+	vm.state = vmTypes.StatePaused
+	return nil
+}
+
+// Resume continues a paused VM.
+func (f *FakeOperator) Resume(ctx context.Context, vmName string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StatePaused {
+		return fmt.Errorf("error resuming VM '%s': VM is %s", vmName, vm.state)
+	}
+	vm.state = vmTypes.StateRunning
+	return nil
+}
+
+// Reset restarts a running VM; the simulated VM simply keeps running.
+func (f *FakeOperator) Reset(ctx context.Context, vmName string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StateRunning {
+		return fmt.Errorf("error resetting VM '%s': VM is %s", vmName, vm.state)
+	}
+	return nil
+}
+
+// Shutdown powers off a running or paused VM.
+// Like the VirtualBox backend, it treats a VM that is not running as success.
+func (f *FakeOperator) Shutdown(ctx context.Context, vmName string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state == vmTypes.StateRunning || vm.state == vmTypes.StatePaused {
+		vm.state = vmTypes.StatePowerOff
+	}
+	return nil
+}
+
+// ACPIShutdown simulates a guest that shuts down as soon as the power button is pressed,
+// unless the VM is declared with ignore_acpi.
+func (f *FakeOperator) ACPIShutdown(ctx context.Context, vmName string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StateRunning {
+		return fmt.Errorf("error sending ACPI shutdown to VM '%s': VM is %s", vmName, vm.state)
+	}
+	if !vm.ignoreACPI {
+		vm.state = vmTypes.StatePowerOff
+	}
+	return nil
+}
+
+// SaveState saves the state of a running or paused VM.
+func (f *FakeOperator) SaveState(ctx context.Context, vmName string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StateRunning && vm.state != vmTypes.StatePaused {
+		return fmt.Errorf("error saving state of VM '%s': VM is %s", vmName, vm.state)
+	}
+	vm.state = vmTypes.StateSaved
+	return nil
+}
+
+// RestoreSnapshot makes the given snapshot current and restores the power state it was taken in.
+// Like VirtualBox, it refuses to restore a snapshot of a running or paused VM.
+func (f *FakeOperator) RestoreSnapshot(ctx context.Context, vmName, snapshot string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	return f.restore(vmName, vm, snapshot)
+}
+
+// restore implements RestoreSnapshot with the lock held.
+func (f *FakeOperator) restore(vmName string, vm *fakeVM, snapshot string) error {
+	if vm.state == vmTypes.StateRunning || vm.state == vmTypes.StatePaused {
+		return fmt.Errorf("error restoring snapshot '%s': VM '%s' is %s", snapshot, vmName, vm.state)
+	}
+	target, err := findFakeSnapshot(vm, snapshot)
+	if err != nil {
+		return fmt.Errorf("error restoring snapshot: %w", err)
+	}
+	if current := vm.tree.Current(); current != nil {
+		current.Current = false
+	}
+	target.Current = true
+	vm.state = vm.snapshotStates[target]
+	return nil
+}
+
+// TakeSnapshot adds a snapshot below the current one and makes it current.
+// Snapshots of a running or paused VM restore it to the saved state; live has no effect.
+func (f *FakeOperator) TakeSnapshot(ctx context.Context, vmName, name, description string, live bool) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	state := vm.state
+	if state == vmTypes.StateRunning || state == vmTypes.StatePaused {
+		state = vmTypes.StateSaved
+	}
+	snapshot := &vmTypes.Snapshot{
+		Name:        name,
+		UUID:        f.newUUID(),
+		Description: description,
+		TimeStamp:   time.Now(),
+		Current:     true,
+	}
+	current := vm.tree.Current()
+	if current != nil {
+		current.Current = false
+	}
+	f.attach(vm, current, snapshot, state)
+	return nil
+}
+
+// DeleteSnapshot removes a snapshot, attaching its child to its parent.
+// Like VirtualBox, it refuses to delete a snapshot with more than one child.
+func (f *FakeOperator) DeleteSnapshot(ctx context.Context, vmName, snapshot string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	target, err := findFakeSnapshot(vm, snapshot)
+	if err != nil {
+		return fmt.Errorf("error deleting snapshot: %w", err)
+	}
+	if len(target.Children) > 1 {
+		return fmt.Errorf("error deleting snapshot '%s': it has %d child snapshots", snapshot, len(target.Children))
+	}
+
+	siblings := &vm.tree.Roots
+	if target.Parent != nil {
+		siblings = &target.Parent.Children
+	}
+	for i, s := range *siblings {
+		if s == target {
+			*siblings = append((*siblings)[:i:i], (*siblings)[i+1:]...)
+			break
+		}
+	}
+	for _, child := range target.Children {
+		child.Parent = target.Parent
+		*siblings = append(*siblings, child)
+	}
+	if target.Current && target.Parent != nil {
+		target.Parent.Current = true
+	}
+	delete(vm.snapshotStates, target)
+	return nil
+}
+
+// Rollback powers the VM off and restores the specified snapshot.
+func (f *FakeOperator) Rollback(ctx context.Context, vmName, snapshot string) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	vm.state = vmTypes.StatePowerOff
+	return f.restore(vmName, vm, snapshot)
+}
+
+// ListSnapshots returns a copy of the VM's snapshot tree.
+func (f *FakeOperator) ListSnapshots(ctx context.Context, vmName string) (*vmTypes.SnapshotTree, error) {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.Unlock()
+	var clone func(parent *vmTypes.Snapshot, snapshots []*vmTypes.Snapshot) []*vmTypes.Snapshot
+	clone = func(parent *vmTypes.Snapshot, snapshots []*vmTypes.Snapshot) []*vmTypes.Snapshot {
+		var copies []*vmTypes.Snapshot
+		for _, s := range snapshots {
+			c := *s
+			c.Parent = parent
+			c.Children = clone(&c, s.Children)
+			copies = append(copies, &c)
+		}
+		return copies
+	}
+	return &vmTypes.SnapshotTree{Roots: clone(nil, vm.tree.Roots)}, nil
+}
+
+// WaitForGuestExecReady succeeds at once if the VM is running. A simulated VM never
+// changes state by itself, so it fails at once otherwise instead of waiting for the timeout.
+func (f *FakeOperator) WaitForGuestExecReady(ctx context.Context, vmName, username, password string, timeout time.Duration) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StateRunning {
+		return fmt.Errorf("guest execution service is not available: VM '%s' is %s", vmName, vm.state)
+	}
+	return nil
+}
+
+// ExecuteShellCommand answers a guest command with the first scripted response that matches it,
+// comparing the command line as configured, so shell command lines match verbatim. The
+// environment, working directory and stdin are ignored. Commands without a scripted response
+// exit with code 127, like an unknown command in a shell.
+func (f *FakeOperator) ExecuteShellCommand(ctx context.Context, vmName, username, password string, cmd vmTypes.GuestCommand) (*vmTypes.CommandResult, error) {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StateRunning {
+		return nil, fmt.Errorf("error executing shell command: VM '%s' is %s", vmName, vm.state)
+	}
+
+	command := cmd.Command
+	commandLine := strings.Join(append([]string{command}, cmd.Args...), " ")
+	logrus.Debugf("Fake guest command on VM '%s' as '%s': %s", vmName, username, cmd)
+	for _, candidate := range []string{commandLine, command} {
+		for _, scripted := range f.commands {
+			if scripted.VMName != "" && scripted.VMName != vmName {
+				continue
+			}
+			if scripted.Command == candidate {
+				return fakeCommandResult(cmd, scripted.Stdout, scripted.Stderr, scripted.ExitCode), nil
+			}
+		}
+	}
+	return fakeCommandResult(cmd, "", fmt.Sprintf("%s: command not found\n", command), 127), nil
+}
+
+// fakeCommandResult passes scripted output through the command's output handling.
+func fakeCommandResult(cmd vmTypes.GuestCommand, stdoutText, stderrText string, exitCode int) *vmTypes.CommandResult {
+	stdout, stderr := cmd.NewCapture("stdout"), cmd.NewCapture("stderr")
+	io.WriteString(stdout, stdoutText)
+	io.WriteString(stderr, stderrText)
+	result := vmTypes.NewCommandResult(stdout, stderr, 0)
+	result.ExitCode = exitCode
+	return result
+}
+
+// CopyToGuest copies host files, and directories if recursive is true,
+// into the VM's simulated file system.
+func (f *FakeOperator) CopyToGuest(ctx context.Context, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StateRunning {
+		return fmt.Errorf("error copying to guest: VM '%s' is %s", vmName, vm.state)
+	}
+
+	for _, source := range sources {
+		root := filepath.Clean(source)
+		info, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("error copying '%s' to guest: %w", source, err)
+		}
+		if info.IsDir() && !recursive {
+			return fmt.Errorf("error copying '%s' to guest: it is a directory and recursive is not set", source)
+		}
+		base := path.Join(targetDir, filepath.Base(root))
+		err = filepath.WalkDir(root, func(hostPath string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, hostPath)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(hostPath)
+			if err != nil {
+				return err
+			}
+			vm.files[path.Join(base, filepath.ToSlash(rel))] = data
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error copying '%s' to guest: %w", source, err)
+		}
+	}
+	return nil
+}
+
+// CopyFromGuest copies files, and directories if recursive is true,
+// from the VM's simulated file system into a host directory.
+func (f *FakeOperator) CopyFromGuest(ctx context.Context, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	vm, err := f.lock(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	if vm.state != vmTypes.StateRunning {
+		return fmt.Errorf("error copying from guest: VM '%s' is %s", vmName, vm.state)
+	}
+
+	for _, source := range sources {
+		source = path.Clean(source)
+		target := filepath.Join(targetDir, path.Base(source))
+		if data, ok := vm.files[source]; ok {
+			if err := os.WriteFile(target, data, 0o644); err != nil {
+				return fmt.Errorf("error copying '%s' from guest: %w", source, err)
+			}
+			continue
+		}
+
+		// Otherwise the source is a directory if any file lives below it.
+		var below []string
+		for guestPath := range vm.files {
+			if strings.HasPrefix(guestPath, source+"/") {
+				below = append(below, guestPath)
+			}
+		}
+		if len(below) == 0 {
+			return fmt.Errorf("error copying '%s' from guest: no such file or directory", source)
+		}
+		if !recursive {
+			return fmt.Errorf("error copying '%s' from guest: it is a directory and recursive is not set", source)
+		}
+		sort.Strings(below)
+		for _, guestPath := range below {
+			hostPath := filepath.Join(target, filepath.FromSlash(strings.TrimPrefix(guestPath, source+"/")))
+			if err := os.MkdirAll(filepath.Dir(hostPath), 0o755); err != nil {
+				return fmt.Errorf("error copying '%s' from guest: %w", source, err)
+			}
+			if err := os.WriteFile(hostPath, vm.files[guestPath], 0o644); err != nil {
+				return fmt.Errorf("error copying '%s' from guest: %w", source, err)
+			}
+		}
+	}
+	return nil
+}
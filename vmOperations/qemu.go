@@ -0,0 +1,108 @@
+package vmOperations
+
+import (
+	"context"
+	"time"
+
+	"vnecro/qemuOperations"
+	"vnecro/vmTypes"
+)
+
+// QemuOperator is a concrete implementation of VMOperator for QEMU/KVM domains managed by libvirt.
+// Power and snapshot operations use virsh, while guest commands and file copies go through
+// the qemu-guest-agent, which runs them with its own privileges instead of the given credentials.
+type QemuOperator struct {
+	// uri is the libvirt connection URI; empty means the libvirt default.
+	uri string
+}
+
+// NewQemuOperator returns a new instance of QemuOperator for the given libvirt connection URI.
+func NewQemuOperator(uri string) VMOperator {
+	return &QemuOperator{uri: uri}
+}
+
+// State queries the state and hardware of the domain using virsh.
+func (q *QemuOperator) State(ctx context.Context, vmName string) (*vmTypes.VMInfo, error) {
+	return qemuOperations.DomainInfo(ctx, q.uri, vmName)
+}
+
+// Start launches the domain using virsh.
+func (q *QemuOperator) Start(ctx context.Context, vmName string) error {
+	return qemuOperations.StartVM(ctx, q.uri, vmName)
+}
+
+// Pause suspends the domain using virsh.
+func (q *QemuOperator) Pause(ctx context.Context, vmName string) error {
+	return qemuOperations.PauseVM(ctx, q.uri, vmName)
+}
+
+// Resume continues the suspended domain using virsh.
+func (q *QemuOperator) Resume(ctx context.Context, vmName string) error {
+	return qemuOperations.ResumeVM(ctx, q.uri, vmName)
+}
+
+// Reset restarts the domain using virsh.
+func (q *QemuOperator) Reset(ctx context.Context, vmName string) error {
+	return qemuOperations.ResetVM(ctx, q.uri, vmName)
+}
+
+// Shutdown powers off the domain using virsh.
+// It handles cases where the domain is already off.
+func (q *QemuOperator) Shutdown(ctx context.Context, vmName string) error {
+	return qemuOperations.ShutdownVM(ctx, q.uri, vmName)
+}
+
+// ACPIShutdown asks the guest to shut down through ACPI using virsh.
+func (q *QemuOperator) ACPIShutdown(ctx context.Context, vmName string) error {
+	return qemuOperations.ACPIShutdownVM(ctx, q.uri, vmName)
+}
+
+// SaveState saves the state of the domain with a libvirt managed save.
+func (q *QemuOperator) SaveState(ctx context.Context, vmName string) error {
+	return qemuOperations.SaveStateVM(ctx, q.uri, vmName)
+}
+
+// RestoreSnapshot reverts the domain to a snapshot, given by name.
+func (q *QemuOperator) RestoreSnapshot(ctx context.Context, vmName, snapshot string) error {
+	return qemuOperations.RestoreSnapshot(ctx, q.uri, vmName, snapshot)
+}
+
+// TakeSnapshot takes an internal snapshot of the domain.
+func (q *QemuOperator) TakeSnapshot(ctx context.Context, vmName, name, description string, live bool) error {
+	return qemuOperations.TakeSnapshot(ctx, q.uri, vmName, name, description)
+}
+
+// DeleteSnapshot removes a snapshot, given by name, from the domain.
+func (q *QemuOperator) DeleteSnapshot(ctx context.Context, vmName, snapshot string) error {
+	return qemuOperations.DeleteSnapshot(ctx, q.uri, vmName, snapshot)
+}
+
+// Rollback reverts the domain to the specified snapshot in case of contingencies.
+func (q *QemuOperator) Rollback(ctx context.Context, vmName, snapshot string) error {
+	return qemuOperations.Rollback(ctx, q.uri, vmName, snapshot)
+}
+
+// ListSnapshots returns the snapshot tree of a domain.
+func (q *QemuOperator) ListSnapshots(ctx context.Context, vmName string) (*vmTypes.SnapshotTree, error) {
+	return qemuOperations.ListSnapshots(ctx, q.uri, vmName)
+}
+
+// WaitForGuestExecReady polls until the guest agent answers, or the timeout expires.
+func (q *QemuOperator) WaitForGuestExecReady(ctx context.Context, vmName, username, password string, timeout time.Duration) error {
+	return qemuOperations.WaitForGuestExecReady(ctx, q.uri, vmName, timeout)
+}
+
+// ExecuteShellCommand runs a command inside the guest OS through the guest agent and returns its result.
+func (q *QemuOperator) ExecuteShellCommand(ctx context.Context, vmName, username, password string, cmd vmTypes.GuestCommand) (*vmTypes.CommandResult, error) {
+	return qemuOperations.ExecuteShellCommand(ctx, q.uri, vmName, cmd)
+}
+
+// CopyToGuest copies host files into the guest OS through the guest agent.
+func (q *QemuOperator) CopyToGuest(ctx context.Context, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	return qemuOperations.CopyToGuest(ctx, q.uri, vmName, sources, targetDir, recursive)
+}
+
+// CopyFromGuest copies guest files to the host through the guest agent.
+func (q *QemuOperator) CopyFromGuest(ctx context.Context, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	return qemuOperations.CopyFromGuest(ctx, q.uri, vmName, sources, targetDir, recursive)
+}
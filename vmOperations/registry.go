@@ -0,0 +1,71 @@
+package vmOperations
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"vnecro/config"
+	"vnecro/vboxOperations"
+)
+
+// Factory creates a VMOperator for a configuration whose vm_manager selects its backend.
+type Factory func(cfg *config.Config) (VMOperator, error)
+
+// backends maps vm_manager names to the factories of their VMOperator implementations.
+var backends = map[string]Factory{
+	"virtualbox": func(cfg *config.Config) (VMOperator, error) {
+		runner, err := newVBoxRunner(cfg.VirtualBox)
+		if err != nil {
+			return nil, err
+		}
+		return NewVirtualBoxOperator(runner), nil
+	},
+	"qemu": func(cfg *config.Config) (VMOperator, error) {
+		return NewQemuOperator(cfg.QEMU.ConnectURI), nil
+	},
+	"fake": func(cfg *config.Config) (VMOperator, error) {
+		return NewFakeOperator(cfg.Fake)
+	},
+}
+
+// Register makes a backend available under the given vm_manager name,
+// replacing any backend previously registered under that name.
+func Register(name string, factory Factory) {
+	backends[name] = factory
+}
+
+// Backends returns the names of all registered backends in sorted order.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newVBoxRunner creates the VBoxManage runner described by the virtualbox section:
+// the configured binary, optionally recording its commands, or a transcript replay.
+func newVBoxRunner(settings config.VirtualBoxConfig) (vboxOperations.Runner, error) {
+	if settings.ReplayTranscript != "" {
+		if settings.RecordTranscript != "" {
+			return nil, fmt.Errorf("record_transcript and replay_transcript cannot be used together")
+		}
+		return vboxOperations.NewReplayRunner(settings.ReplayTranscript)
+	}
+	var runner vboxOperations.Runner = vboxOperations.NewExecRunner(settings.VBoxManagePath)
+	if settings.RecordTranscript != "" {
+		runner = vboxOperations.NewRecordingRunner(runner, settings.RecordTranscript)
+	}
+	return runner, nil
+}
+
+// New creates the VMOperator selected by the configuration's vm_manager field.
+func New(cfg *config.Config) (VMOperator, error) {
+	factory, ok := backends[cfg.VMManager]
+	if !ok {
+		return nil, fmt.Errorf("unsupported VM manager: %s (supported: %s)", cfg.VMManager, strings.Join(Backends(), ", "))
+	}
+	return factory(cfg)
+}
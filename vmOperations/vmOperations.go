@@ -1,93 +1,177 @@
 package vmOperations
 
 import (
+	"context"
+	"io"
 	"time"
 
 	"vnecro/vboxOperations"
+	"vnecro/vmTypes"
 )
 
 // VMOperator defines the interface for performing operations on virtual machines.
 // This abstraction allows for different backends (e.g., VirtualBox, Hyper-V, etc.).
+// Every method takes a context; cancelling it aborts the underlying backend call.
 type VMOperator interface {
+	// State returns the power state and hardware of the virtual machine identified by vmName.
+	State(ctx context.Context, vmName string) (*vmTypes.VMInfo, error)
+
 	// Start launches the virtual machine identified by vmName.
-	Start(vmName string) error
+	Start(ctx context.Context, vmName string) error
 
 	// Pause suspends the virtual machine identified by vmName.
-	Pause(vmName string) error
+	Pause(ctx context.Context, vmName string) error
+
+	// Resume continues the paused virtual machine identified by vmName.
+	Resume(ctx context.Context, vmName string) error
+
+	// Reset restarts the virtual machine identified by vmName, like pressing its reset button.
+	Reset(ctx context.Context, vmName string) error
 
 	// Shutdown turns off the virtual machine identified by vmName.
-	Shutdown(vmName string) error
+	Shutdown(ctx context.Context, vmName string) error
 
-	// RestoreSnapshot reverts the virtual machine to the specified snapshot.
-	RestoreSnapshot(vmName, snapshot string) error
+	// ACPIShutdown presses the ACPI power button of the virtual machine, asking the guest
+	// to shut down. It returns without waiting for the guest.
+	ACPIShutdown(ctx context.Context, vmName string) error
 
-	// Rollback reverts the virtual machine to the specified snapshot in case of contingencies.
-	Rollback(vmName, snapshot string) error
+	// SaveState saves the state of the virtual machine to disk and stops it.
+	SaveState(ctx context.Context, vmName string) error
 
-	// ListSnapshots returns a string with the list of snapshots for the virtual machine.
-	ListSnapshots(vmName string) (string, error)
+	// RestoreSnapshot reverts the virtual machine to the specified snapshot, given by name or UUID.
+	RestoreSnapshot(ctx context.Context, vmName, snapshot string) error
+
+	// TakeSnapshot takes a snapshot of the virtual machine with the given name and description.
+	// If live is true, the snapshot is taken without pausing a running virtual machine.
+	TakeSnapshot(ctx context.Context, vmName, name, description string, live bool) error
+
+	// DeleteSnapshot removes the specified snapshot, given by name or UUID.
+	DeleteSnapshot(ctx context.Context, vmName, snapshot string) error
+
+	// Rollback reverts the virtual machine to the specified snapshot in case of contingencies.
+	Rollback(ctx context.Context, vmName, snapshot string) error
 
-	// ParseSnapshot extracts a clean snapshot name from the given snapshot output.
-	ParseSnapshot(snapshotOutput string) (string, error)
+	// ListSnapshots returns the snapshot tree of the virtual machine.
+	ListSnapshots(ctx context.Context, vmName string) (*vmTypes.SnapshotTree, error)
 
 	// WaitForGuestExecReady waits until the guest execution service is ready,
 	// given the VM name, credentials, and a timeout duration.
-	WaitForGuestExecReady(vmName, username, password string, timeout time.Duration) error
+	WaitForGuestExecReady(ctx context.Context, vmName, username, password string, timeout time.Duration) error
 
-	// ExecuteShellCommand executes a command inside the guest OS with the provided arguments.
-	ExecuteShellCommand(vmName, username, password, command string, args ...string) (string, error)
+	// CopyToGuest copies host files or directories into the targetDir inside the guest OS.
+	// Directories are only copied if recursive is true.
+	CopyToGuest(ctx context.Context, vmName, username, password string, sources []string, targetDir string, recursive bool) error
+
+	// CopyFromGuest copies guest files or directories into the targetDir on the host.
+	// Directories are only copied if recursive is true.
+	CopyFromGuest(ctx context.Context, vmName, username, password string, sources []string, targetDir string, recursive bool) error
+
+	// ExecuteShellCommand executes a command inside the guest OS.
+	// A non-zero exit code of the command is reported in the result, not as an error.
+	ExecuteShellCommand(ctx context.Context, vmName, username, password string, cmd vmTypes.GuestCommand) (*vmTypes.CommandResult, error)
 }
 
 // VirtualBoxOperator is a concrete implementation of VMOperator using VirtualBox's VBoxManage tool.
-type VirtualBoxOperator struct{}
+type VirtualBoxOperator struct {
+	// runner runs the VBoxManage commands.
+	runner vboxOperations.Runner
+}
+
+// NewVirtualBoxOperator returns a new instance of VirtualBoxOperator running VBoxManage through runner.
+func NewVirtualBoxOperator(runner vboxOperations.Runner) VMOperator {
+	return &VirtualBoxOperator{runner: runner}
+}
+
+// Close releases the runner, e.g. a RecordingRunner's transcript, if it needs releasing.
+func (v *VirtualBoxOperator) Close() error {
+	if closer, ok := v.runner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
 
-// NewVirtualBoxOperator returns a new instance of VirtualBoxOperator.
-func NewVirtualBoxOperator() VMOperator {
-	return &VirtualBoxOperator{}
+// State queries the state and hardware of the virtual machine using VBoxManage showvminfo.
+func (v *VirtualBoxOperator) State(ctx context.Context, vmName string) (*vmTypes.VMInfo, error) {
+	return vboxOperations.ShowVMInfo(ctx, v.runner, vmName)
 }
 
 // Start launches the virtual machine using VBoxManage.
-func (v *VirtualBoxOperator) Start(vmName string) error {
-	return vboxOperations.StartVM(vmName)
+func (v *VirtualBoxOperator) Start(ctx context.Context, vmName string) error {
+	return vboxOperations.StartVM(ctx, v.runner, vmName)
 }
 
 // Pause suspends the virtual machine using VBoxManage.
-func (v *VirtualBoxOperator) Pause(vmName string) error {
-	return vboxOperations.PauseVM(vmName)
+func (v *VirtualBoxOperator) Pause(ctx context.Context, vmName string) error {
+	return vboxOperations.PauseVM(ctx, v.runner, vmName)
+}
+
+// Resume continues the paused virtual machine using VBoxManage.
+func (v *VirtualBoxOperator) Resume(ctx context.Context, vmName string) error {
+	return vboxOperations.ResumeVM(ctx, v.runner, vmName)
+}
+
+// Reset restarts the virtual machine using VBoxManage.
+func (v *VirtualBoxOperator) Reset(ctx context.Context, vmName string) error {
+	return vboxOperations.ResetVM(ctx, v.runner, vmName)
 }
 
 // Shutdown turns off the virtual machine using VBoxManage.
-// It handles cases where the VM is already off or aborted.
-func (v *VirtualBoxOperator) Shutdown(vmName string) error {
-	return vboxOperations.ShutdownVM(vmName)
+// It handles cases where the VM is already off, saved or aborted.
+func (v *VirtualBoxOperator) Shutdown(ctx context.Context, vmName string) error {
+	return vboxOperations.ShutdownVM(ctx, v.runner, vmName)
 }
 
-// RestoreSnapshot reverts the virtual machine to a specified snapshot.
-func (v *VirtualBoxOperator) RestoreSnapshot(vmName, snapshot string) error {
-	return vboxOperations.RestoreSnapshot(vmName, snapshot)
+// ACPIShutdown presses the ACPI power button of the virtual machine using VBoxManage.
+func (v *VirtualBoxOperator) ACPIShutdown(ctx context.Context, vmName string) error {
+	return vboxOperations.ACPIShutdownVM(ctx, v.runner, vmName)
 }
 
-// Rollback reverts the virtual machine to the specified snapshot in case of contingencies.
-func (v *VirtualBoxOperator) Rollback(vmName, snapshot string) error {
-	return vboxOperations.Rollback(vmName, snapshot)
+// SaveState saves the state of the virtual machine using VBoxManage.
+func (v *VirtualBoxOperator) SaveState(ctx context.Context, vmName string) error {
+	return vboxOperations.SaveStateVM(ctx, v.runner, vmName)
 }
 
-// ListSnapshots returns the snapshot list of a virtual machine.
-func (v *VirtualBoxOperator) ListSnapshots(vmName string) (string, error) {
-	return vboxOperations.ListSnapshots(vmName)
+// RestoreSnapshot reverts the virtual machine to a specified snapshot, given by name or UUID.
+func (v *VirtualBoxOperator) RestoreSnapshot(ctx context.Context, vmName, snapshot string) error {
+	return vboxOperations.RestoreSnapshot(ctx, v.runner, vmName, snapshot)
 }
 
-// ParseSnapshot extracts a clean snapshot name from the snapshot list output.
-func (v *VirtualBoxOperator) ParseSnapshot(snapshotOutput string) (string, error) {
-	return vboxOperations.ParseSnapshot(snapshotOutput)
+// TakeSnapshot takes a snapshot of the virtual machine.
+func (v *VirtualBoxOperator) TakeSnapshot(ctx context.Context, vmName, name, description string, live bool) error {
+	return vboxOperations.TakeSnapshot(ctx, v.runner, vmName, name, description, live)
+}
+
+// DeleteSnapshot removes a snapshot, given by name or UUID, from the virtual machine.
+func (v *VirtualBoxOperator) DeleteSnapshot(ctx context.Context, vmName, snapshot string) error {
+	return vboxOperations.DeleteSnapshot(ctx, v.runner, vmName, snapshot)
+}
+
+// Rollback reverts the virtual machine to the specified snapshot in case of contingencies.
+func (v *VirtualBoxOperator) Rollback(ctx context.Context, vmName, snapshot string) error {
+	return vboxOperations.Rollback(ctx, v.runner, vmName, snapshot)
+}
+
+// ListSnapshots returns the snapshot tree of a virtual machine.
+func (v *VirtualBoxOperator) ListSnapshots(ctx context.Context, vmName string) (*vmTypes.SnapshotTree, error) {
+	return vboxOperations.ListSnapshots(ctx, v.runner, vmName)
 }
 
 // WaitForGuestExecReady polls until the guest execution service is ready, or the timeout expires.
-func (v *VirtualBoxOperator) WaitForGuestExecReady(vmName, username, password string, timeout time.Duration) error {
-	return vboxOperations.WaitForGuestExecReady(vmName, username, password, timeout)
+func (v *VirtualBoxOperator) WaitForGuestExecReady(ctx context.Context, vmName, username, password string, timeout time.Duration) error {
+	return vboxOperations.WaitForGuestExecReady(ctx, v.runner, vmName, username, password, timeout)
+}
+
+// ExecuteShellCommand runs a shell command inside the guest OS and returns its result.
+func (v *VirtualBoxOperator) ExecuteShellCommand(ctx context.Context, vmName, username, password string, cmd vmTypes.GuestCommand) (*vmTypes.CommandResult, error) {
+	return vboxOperations.ExecuteShellCommand(ctx, v.runner, vmName, username, password, cmd)
+}
+
+// CopyToGuest copies host files or directories into the guest OS using VBoxManage guestcontrol.
+func (v *VirtualBoxOperator) CopyToGuest(ctx context.Context, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	return vboxOperations.CopyToGuest(ctx, v.runner, vmName, username, password, sources, targetDir, recursive)
 }
 
-// ExecuteShellCommand runs a shell command inside the guest OS and returns its output.
-func (v *VirtualBoxOperator) ExecuteShellCommand(vmName, username, password, command string, args ...string) (string, error) {
-	return vboxOperations.ExecuteShellCommand(vmName, username, password, command, args...)
+// CopyFromGuest copies guest files or directories to the host using VBoxManage guestcontrol.
+func (v *VirtualBoxOperator) CopyFromGuest(ctx context.Context, vmName, username, password string, sources []string, targetDir string, recursive bool) error {
+	return vboxOperations.CopyFromGuest(ctx, v.runner, vmName, username, password, sources, targetDir, recursive)
 }
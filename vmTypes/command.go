@@ -0,0 +1,73 @@
+package vmTypes
+
+import (
+	"strings"
+	"time"
+)
+
+// GuestCommand is a process to run inside the guest OS.
+type GuestCommand struct {
+	// Command is the executable to run or, if Shell is set, a shell command line.
+	Command string
+	// Args are the command's arguments, or the positional parameters ($1, $2, ...)
+	// of the command line if Shell is set.
+	Args []string
+	// Shell ("sh" or "bash"), if set, runs Command with "<shell> -c", so that it may
+	// use pipes, redirects and other shell syntax.
+	Shell string
+	// SearchPath resolves the executable through the guest's PATH. Otherwise a
+	// relative executable is taken from /bin/.
+	SearchPath bool
+	// Env holds extra environment variables as NAME=VALUE.
+	Env []string
+	// Cwd is the working directory; empty means the guest's default.
+	Cwd string
+	// StdinFile, if set, is a guest file that the command's standard input is
+	// redirected from.
+	StdinFile string
+	// OnOutput, if set, is called with each line the command prints, as it prints it
+	// where the backend allows, with stream "stdout" or "stderr".
+	OnOutput func(stream, line string)
+	// MaxOutputBytes caps how much of stdout and of stderr is kept in the result;
+	// 0 means no limit.
+	MaxOutputBytes int
+}
+
+// Argv returns the executable and arguments a backend starts for the command,
+// after applying Shell, SearchPath and StdinFile.
+func (c GuestCommand) Argv() (string, []string) {
+	exe, args := c.Command, c.Args
+	if c.Shell != "" {
+		exe, args = c.Shell, append([]string{"-c", c.Command, c.Shell}, c.Args...)
+	}
+	switch {
+	case c.SearchPath:
+		// env(1) looks the executable up in PATH.
+		exe, args = "/usr/bin/env", append([]string{exe}, args...)
+	case !strings.HasPrefix(exe, "/"):
+		exe = "/bin/" + exe
+	}
+	if c.StdinFile != "" {
+		exe, args = "/bin/sh", append([]string{"-c", `exec "$@" < "$0"`, c.StdinFile, exe}, args...)
+	}
+	return exe, args
+}
+
+// String returns the command line as written in the configuration.
+func (c GuestCommand) String() string {
+	line := strings.Join(append([]string{c.Command}, c.Args...), " ")
+	if c.Shell != "" {
+		line = c.Shell + ": " + line
+	}
+	return line
+}
+
+// CommandResult is the outcome of a command executed inside the guest OS.
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+	// Truncated reports that output beyond the command's MaxOutputBytes was dropped.
+	Truncated bool
+}
@@ -0,0 +1,93 @@
+package vmTypes
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// maxLineBytes bounds how much of an unterminated line is buffered before it is
+// passed on, so a command printing without newlines cannot grow the buffer forever.
+const maxLineBytes = 64 * 1024
+
+// OutputCapture is an io.Writer that collects one output stream of a guest command.
+// It keeps at most the command's MaxOutputBytes, and passes each complete line to the
+// command's OnOutput callback as soon as it is written.
+type OutputCapture struct {
+	stream    string
+	onLine    func(stream, line string)
+	limit     int
+	data      []byte
+	line      []byte
+	truncated bool
+}
+
+// NewCapture returns an OutputCapture for the named stream ("stdout" or "stderr") of c.
+func (c GuestCommand) NewCapture(stream string) *OutputCapture {
+	return &OutputCapture{stream: stream, onLine: c.OnOutput, limit: c.MaxOutputBytes}
+}
+
+// Write captures p and passes on the lines it completes. It never fails.
+func (o *OutputCapture) Write(p []byte) (int, error) {
+	kept := p
+	if o.limit > 0 && len(o.data)+len(kept) > o.limit {
+		kept = kept[:max(o.limit-len(o.data), 0)]
+		o.truncated = true
+	}
+	o.data = append(o.data, kept...)
+
+	if o.onLine == nil {
+		return len(p), nil
+	}
+	o.line = append(o.line, p...)
+	for {
+		i := bytes.IndexByte(o.line, '\n')
+		if i < 0 {
+			break
+		}
+		o.onLine(o.stream, strings.TrimSuffix(string(o.line[:i]), "\r"))
+		o.line = o.line[i+1:]
+	}
+	if len(o.line) > maxLineBytes {
+		o.Flush()
+	}
+	// Drop the consumed lines so the buffer does not keep growing.
+	o.line = append([]byte(nil), o.line...)
+	return len(p), nil
+}
+
+// Flush passes on the last line if the output did not end with a newline.
+func (o *OutputCapture) Flush() {
+	if o.onLine != nil && len(o.line) > 0 {
+		o.onLine(o.stream, strings.TrimSuffix(string(o.line), "\r"))
+	}
+	o.line = nil
+}
+
+// String returns the captured output.
+func (o *OutputCapture) String() string {
+	return string(o.data)
+}
+
+// Limit returns the most bytes the capture keeps; 0 means no limit.
+func (o *OutputCapture) Limit() int {
+	return o.limit
+}
+
+// Truncated reports whether output was dropped because of the MaxOutputBytes limit.
+func (o *OutputCapture) Truncated() bool {
+	return o.truncated
+}
+
+// NewCommandResult flushes the captured stdout and stderr of a command and returns
+// its result. The caller fills in the exit code.
+func NewCommandResult(stdout, stderr *OutputCapture, duration time.Duration) *CommandResult {
+	stdout.Flush()
+	stderr.Flush()
+	return &CommandResult{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+		Duration:  duration,
+	}
+}
@@ -0,0 +1,109 @@
+package vmTypes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Snapshot is a single node of a virtual machine's snapshot tree.
+type Snapshot struct {
+	Name        string
+	UUID        string
+	Description string
+	// TimeStamp is when the snapshot was taken; it is zero if the backend cannot tell.
+	TimeStamp time.Time
+	// Current marks the snapshot the VM's current state is based on.
+	Current  bool
+	Parent   *Snapshot
+	Children []*Snapshot
+}
+
+// SnapshotTree holds every snapshot of a virtual machine.
+type SnapshotTree struct {
+	Roots []*Snapshot
+}
+
+// All returns every snapshot in the tree in depth-first order, parents before children.
+func (t *SnapshotTree) All() []*Snapshot {
+	var all []*Snapshot
+	var walk func(nodes []*Snapshot)
+	walk = func(nodes []*Snapshot) {
+		for _, s := range nodes {
+			all = append(all, s)
+			walk(s.Children)
+		}
+	}
+	walk(t.Roots)
+	return all
+}
+
+// Current returns the snapshot marked as current, or nil if there is none.
+func (t *SnapshotTree) Current() *Snapshot {
+	for _, s := range t.All() {
+		if s.Current {
+			return s
+		}
+	}
+	return nil
+}
+
+// Latest returns the most recently taken snapshot, or nil if the tree is empty.
+// If timestamps are unknown, the last snapshot in tree order is returned.
+func (t *SnapshotTree) Latest() *Snapshot {
+	var latest *Snapshot
+	for _, s := range t.All() {
+		if latest == nil || !s.TimeStamp.Before(latest.TimeStamp) {
+			latest = s
+		}
+	}
+	return latest
+}
+
+// FindByUUID returns the snapshot with the given UUID, or nil if there is none.
+func (t *SnapshotTree) FindByUUID(uuid string) *Snapshot {
+	uuid = strings.Trim(strings.ToLower(uuid), "{}")
+	for _, s := range t.All() {
+		if strings.Trim(strings.ToLower(s.UUID), "{}") == uuid {
+			return s
+		}
+	}
+	return nil
+}
+
+// FindByName returns every snapshot with the given name in tree order.
+// Snapshot names are not required to be unique.
+func (t *SnapshotTree) FindByName(name string) []*Snapshot {
+	var found []*Snapshot
+	for _, s := range t.All() {
+		if s.Name == name {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// String renders the tree with one indented line per snapshot, marking the current one with '*'.
+func (t *SnapshotTree) String() string {
+	var sb strings.Builder
+	var walk func(nodes []*Snapshot, depth int)
+	walk = func(nodes []*Snapshot, depth int) {
+		for _, s := range nodes {
+			sb.WriteString(strings.Repeat("  ", depth))
+			sb.WriteString(fmt.Sprintf("%s (UUID: %s)", s.Name, s.UUID))
+			if !s.TimeStamp.IsZero() {
+				sb.WriteString(" taken " + s.TimeStamp.Local().Format("2006-01-02 15:04:05"))
+			}
+			if s.Current {
+				sb.WriteString(" *")
+			}
+			sb.WriteString("\n")
+			walk(s.Children, depth+1)
+		}
+	}
+	walk(t.Roots, 0)
+	if sb.Len() == 0 {
+		return "(no snapshots)"
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
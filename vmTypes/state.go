@@ -0,0 +1,54 @@
+package vmTypes
+
+// VMState is the power state of a virtual machine. The names follow VirtualBox's
+// VMState values; other backends map their states onto them.
+type VMState string
+
+const (
+	StatePowerOff   VMState = "poweroff"
+	StateRunning    VMState = "running"
+	StatePaused     VMState = "paused"
+	StateSaved      VMState = "saved"
+	StateAborted    VMState = "aborted"
+	StateStuck      VMState = "stuck"
+	StateStarting   VMState = "starting"
+	StateStopping   VMState = "stopping"
+	StateSaving     VMState = "saving"
+	StateRestoring  VMState = "restoring"
+	StateSnapshot   VMState = "snapshotting"
+	StateTeleported VMState = "teleported"
+	StateUnknown    VMState = "unknown"
+)
+
+// KnownStates lists every state a backend reports, for validating configured states.
+var KnownStates = []VMState{
+	StatePowerOff, StateRunning, StatePaused, StateSaved, StateAborted, StateStuck,
+	StateStarting, StateStopping, StateSaving, StateRestoring, StateSnapshot,
+	StateTeleported, StateUnknown,
+}
+
+// IsOff reports whether the VM is not running at all, i.e. powered off, saved or aborted.
+func (s VMState) IsOff() bool {
+	return s == StatePowerOff || s == StateSaved || s == StateAborted || s == StateTeleported
+}
+
+// NIC is a network adapter of a virtual machine.
+type NIC struct {
+	// Index is the adapter's slot, starting at 1.
+	Index int
+	// Attachment is how the adapter is connected, e.g. "nat", "bridged" or "network".
+	Attachment string
+	// Network is the bridged interface or network name the adapter is attached to, if any.
+	Network    string
+	MACAddress string
+}
+
+// VMInfo describes a virtual machine's state and hardware.
+type VMInfo struct {
+	State  VMState
+	OSType string
+	// MemoryMB is the configured memory in MiB.
+	MemoryMB int
+	CPUs     int
+	NICs     []NIC
+}